@@ -0,0 +1,13 @@
+package doppler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDoppler(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Doppler Suite")
+}
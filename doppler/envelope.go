@@ -0,0 +1,120 @@
+package doppler
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// Field numbers and values of the dropsonde Envelope and LogMessage protocol
+// buffers that are read from the stream.
+const (
+	envelopeEventType  = 2
+	envelopeLogMessage = 8
+
+	eventTypeLogMessage = 5
+
+	logMessageMessage        = 1
+	logMessageMessageType    = 2
+	logMessageTimestamp      = 3
+	logMessageSourceType     = 5
+	logMessageSourceInstance = 6
+
+	messageTypeErr = 2
+)
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+var errMalformed = errors.New("malformed envelope")
+
+// decodeEnvelope returns the log message in an envelope, and false if the
+// envelope holds another type of event.
+func decodeEnvelope(data []byte) (remote.LogMessage, bool, error) {
+	var eventType uint64
+	var logMessage []byte
+	err := eachField(data, func(number int, value uint64, bytes []byte) {
+		switch number {
+		case envelopeEventType:
+			eventType = value
+		case envelopeLogMessage:
+			logMessage = bytes
+		}
+	})
+	if err != nil || eventType != eventTypeLogMessage || logMessage == nil {
+		return remote.LogMessage{}, false, err
+	}
+
+	var message remote.LogMessage
+	err = eachField(logMessage, func(number int, value uint64, bytes []byte) {
+		switch number {
+		case logMessageMessage:
+			message.Message = string(bytes)
+		case logMessageMessageType:
+			message.Stderr = value == messageTypeErr
+		case logMessageTimestamp:
+			message.Time = time.Unix(0, int64(value))
+		case logMessageSourceType:
+			message.Source = string(bytes)
+		case logMessageSourceInstance:
+			message.Instance = string(bytes)
+		}
+	})
+	if err != nil {
+		return remote.LogMessage{}, false, err
+	}
+	return message, true, nil
+}
+
+// eachField calls fn with the number and value of each field in an encoded
+// protocol buffer. Length-delimited fields are passed as bytes and other
+// fields as value.
+func eachField(data []byte, fn func(number int, value uint64, bytes []byte)) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errMalformed
+		}
+		data = data[n:]
+
+		var value uint64
+		var bytes []byte
+		switch key & 7 {
+		case wireVarint:
+			value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errMalformed
+			}
+			data = data[n:]
+		case wire64:
+			if len(data) < 8 {
+				return errMalformed
+			}
+			value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errMalformed
+			}
+			bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case wire32:
+			if len(data) < 4 {
+				return errMalformed
+			}
+			value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return errMalformed
+		}
+		fn(int(key>>3), value, bytes)
+	}
+	return nil
+}
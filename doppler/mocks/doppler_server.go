@@ -0,0 +1,153 @@
+package mocks
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Frame is a websocket frame sent by the server.
+type Frame struct {
+	Opcode  byte
+	Final   bool
+	Payload []byte
+}
+
+type DopplerServer struct {
+	Token    string
+	Paths    chan string
+	Frames   chan Frame
+	Pongs    chan []byte
+	Closed   chan struct{}
+	listener net.Listener
+	server   *http.Server
+}
+
+func (s *DopplerServer) Start() (address string) {
+	Expect(s.listener).To(BeNil(), "test server already started")
+
+	var err error
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	s.Paths = make(chan string, 10)
+	s.Frames = make(chan Frame)
+	s.Pongs = make(chan []byte, 10)
+	s.Closed = make(chan struct{}, 10)
+	s.server = &http.Server{Handler: http.HandlerFunc(s.handle)}
+	go s.server.Serve(s.listener)
+
+	return s.listener.Addr().String()
+}
+
+func (s *DopplerServer) Stop() {
+	if s.listener == nil {
+		return
+	}
+	s.server.Close()
+	s.listener = nil
+}
+
+// Send sends a message as a single final binary frame.
+func (s *DopplerServer) Send(payload []byte) {
+	s.Frames <- Frame{Opcode: 0x2, Final: true, Payload: payload}
+}
+
+func (s *DopplerServer) handle(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+
+	if r.Header.Get("Authorization") != s.Token {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	Expect(r.Header.Get("Upgrade")).To(Equal("websocket"))
+	Expect(r.Header.Get("Connection")).To(Equal("Upgrade"))
+	Expect(r.Header.Get("Sec-WebSocket-Version")).To(Equal("13"))
+	s.Paths <- r.URL.Path
+
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	conn, buffer, err := w.(http.Hijacker).Hijack()
+	Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go s.readFrames(buffer.Reader, done)
+
+	for {
+		select {
+		case frame := <-s.Frames:
+			if _, err := conn.Write(encodeFrame(frame)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// readFrames reads the client's frames, which must be masked, recording pongs
+// and closes.
+func (s *DopplerServer) readFrames(reader *bufio.Reader, done chan<- struct{}) {
+	defer GinkgoRecover()
+	defer close(done)
+
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			s.Closed <- struct{}{}
+			return
+		}
+		Expect(header[1]&0x80).NotTo(BeZero(), "client frame is not masked")
+		length := int(header[1] & 0x7f)
+		Expect(length).To(BeNumerically("<", 126))
+
+		mask := make([]byte, 4)
+		payload := make([]byte, length)
+		_, err := io.ReadFull(reader, mask)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.ReadFull(reader, payload)
+		Expect(err).NotTo(HaveOccurred())
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch header[0] & 0x0f {
+		case 0x8:
+			s.Closed <- struct{}{}
+			return
+		case 0xa:
+			s.Pongs <- payload
+		}
+	}
+}
+
+func encodeFrame(frame Frame) []byte {
+	first := frame.Opcode
+	if frame.Final {
+		first |= 0x80
+	}
+	encoded := []byte{first}
+	switch {
+	case len(frame.Payload) < 126:
+		encoded = append(encoded, byte(len(frame.Payload)))
+	case len(frame.Payload) <= 0xffff:
+		encoded = append(encoded, 126, byte(len(frame.Payload)>>8), byte(len(frame.Payload)))
+	default:
+		encoded = append(encoded, 127)
+		encoded = append(encoded, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(encoded[len(encoded)-8:], uint64(len(frame.Payload)))
+	}
+	return append(encoded, frame.Payload...)
+}
@@ -0,0 +1,73 @@
+package mocks
+
+import "encoding/binary"
+
+// LogEnvelope encodes a dropsonde Envelope that holds a LogMessage.
+func LogEnvelope(message string, stderr bool, timestamp int64, sourceType, sourceInstance string) []byte {
+	messageType := uint64(1)
+	if stderr {
+		messageType = 2
+	}
+
+	var logMessage []byte
+	logMessage = appendBytes(logMessage, 1, []byte(message))
+	logMessage = appendVarint(logMessage, 2, messageType)
+	logMessage = appendVarint(logMessage, 3, uint64(timestamp))
+	logMessage = appendBytes(logMessage, 4, []byte("some-app-guid"))
+	logMessage = appendBytes(logMessage, 5, []byte(sourceType))
+	logMessage = appendBytes(logMessage, 6, []byte(sourceInstance))
+
+	var envelope []byte
+	envelope = appendBytes(envelope, 1, []byte("doppler"))
+	envelope = appendVarint(envelope, 2, 5)
+	envelope = appendVarint(envelope, 6, uint64(timestamp))
+	return appendBytes(envelope, 8, logMessage)
+}
+
+// MetricEnvelope encodes a dropsonde Envelope that holds a ValueMetric.
+func MetricEnvelope() []byte {
+	var valueMetric []byte
+	valueMetric = appendBytes(valueMetric, 1, []byte("some-metric"))
+	valueMetric = appendFixed64(valueMetric, 2, 42)
+	valueMetric = appendBytes(valueMetric, 3, []byte("ms"))
+
+	var envelope []byte
+	envelope = appendBytes(envelope, 1, []byte("doppler"))
+	envelope = appendVarint(envelope, 2, 6)
+	envelope = appendFixed32(envelope, 99, 7)
+	return appendBytes(envelope, 5, valueMetric)
+}
+
+func appendVarint(data []byte, number int, value uint64) []byte {
+	data = appendKey(data, number, 0)
+	return appendUvarint(data, value)
+}
+
+func appendBytes(data []byte, number int, value []byte) []byte {
+	data = appendKey(data, number, 2)
+	data = appendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func appendFixed64(data []byte, number int, value uint64) []byte {
+	data = appendKey(data, number, 1)
+	fixed := make([]byte, 8)
+	binary.LittleEndian.PutUint64(fixed, value)
+	return append(data, fixed...)
+}
+
+func appendFixed32(data []byte, number int, value uint32) []byte {
+	data = appendKey(data, number, 5)
+	fixed := make([]byte, 4)
+	binary.LittleEndian.PutUint32(fixed, value)
+	return append(data, fixed...)
+}
+
+func appendKey(data []byte, number int, wireType uint64) []byte {
+	return appendUvarint(data, uint64(number)<<3|wireType)
+}
+
+func appendUvarint(data []byte, value uint64) []byte {
+	encoded := make([]byte, binary.MaxVarintLen64)
+	return append(data, encoded[:binary.PutUvarint(encoded, value)]...)
+}
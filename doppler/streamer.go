@@ -0,0 +1,57 @@
+package doppler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+	"github.com/pivotal-cf/cf-watch/websocket"
+)
+
+// Streamer reads an app's logs from the Doppler websocket stream.
+type Streamer struct{}
+
+// Stream connects to the app's stream and returns a channel of its log
+// messages. The channel is closed when the stream ends or fails, and the
+// connection is closed when stop is closed.
+func (*Streamer) Stream(endpoint, token, appGUID string, skipSSLValidation bool, stop <-chan struct{}) (<-chan remote.LogMessage, error) {
+	header := http.Header{"Authorization": []string{token}}
+	c, err := websocket.Dial(endpoint, "/apps/"+url.PathEscape(appGUID)+"/stream", header, skipSSLValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		c.Close()
+	}()
+
+	messages := make(chan remote.LogMessage)
+	go func() {
+		defer close(messages)
+		defer close(done)
+		for {
+			data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			message, ok, err := decodeEnvelope(data)
+			if err != nil {
+				return
+			}
+			if !ok {
+				continue
+			}
+			select {
+			case messages <- message:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return messages, nil
+}
@@ -0,0 +1,128 @@
+package doppler_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/pivotal-cf/cf-watch/doppler"
+	"github.com/pivotal-cf/cf-watch/doppler/mocks"
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+var _ = Describe("Streamer", func() {
+	var (
+		streamer          *Streamer
+		mockDopplerServer *mocks.DopplerServer
+		endpoint          string
+		stop              chan struct{}
+	)
+
+	BeforeEach(func() {
+		streamer = &Streamer{}
+		mockDopplerServer = &mocks.DopplerServer{Token: "bearer some-token"}
+		endpoint = "ws://" + mockDopplerServer.Start()
+		stop = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		mockDopplerServer.Stop()
+	})
+
+	Describe("#Stream", func() {
+		It("should stream the app's log messages", func() {
+			messages, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mockDopplerServer.Paths).To(Receive(Equal("/apps/some-app-guid/stream")))
+
+			timestamp := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+			mockDopplerServer.Send(mocks.LogEnvelope("some-output\n", false, timestamp.UnixNano(), "APP/PROC/WEB", "0"))
+			Eventually(messages).Should(Receive(Equal(remote.LogMessage{
+				Time:     timestamp.Local(),
+				Source:   "APP/PROC/WEB",
+				Instance: "0",
+				Message:  "some-output\n",
+			})))
+
+			mockDopplerServer.Send(mocks.LogEnvelope("some-error", true, timestamp.UnixNano(), "RTR", "1"))
+			Eventually(messages).Should(Receive(Equal(remote.LogMessage{
+				Time:     timestamp.Local(),
+				Source:   "RTR",
+				Instance: "1",
+				Stderr:   true,
+				Message:  "some-error",
+			})))
+
+			close(stop)
+			Eventually(mockDopplerServer.Closed).Should(Receive())
+		})
+
+		It("should skip envelopes that hold other events", func() {
+			messages, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			mockDopplerServer.Send(mocks.MetricEnvelope())
+			mockDopplerServer.Send(mocks.LogEnvelope("some-output", false, 0, "APP/PROC/WEB", "0"))
+			var message remote.LogMessage
+			Eventually(messages).Should(Receive(&message))
+			Expect(message.Message).To(Equal("some-output"))
+			close(stop)
+		})
+
+		It("should assemble fragmented and extended-length messages", func() {
+			messages, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			long := string(bytes.Repeat([]byte("a"), 70000))
+			envelope := mocks.LogEnvelope(long, false, 0, "APP/PROC/WEB", "0")
+			mockDopplerServer.Frames <- mocks.Frame{Opcode: 0x2, Payload: envelope[:200]}
+			mockDopplerServer.Frames <- mocks.Frame{Opcode: 0x0, Final: true, Payload: envelope[200:]}
+			var message remote.LogMessage
+			Eventually(messages).Should(Receive(&message))
+			Expect(message.Message).To(Equal(long))
+			close(stop)
+		})
+
+		It("should answer pings", func() {
+			_, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			mockDopplerServer.Frames <- mocks.Frame{Opcode: 0x9, Final: true, Payload: []byte("some-ping")}
+			Eventually(mockDopplerServer.Pongs).Should(Receive(Equal([]byte("some-ping"))))
+			close(stop)
+		})
+
+		It("should close the channel when the server closes the stream", func() {
+			messages, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			mockDopplerServer.Frames <- mocks.Frame{Opcode: 0x8, Final: true}
+			Eventually(messages).Should(BeClosed())
+			Eventually(mockDopplerServer.Closed).Should(Receive())
+		})
+
+		It("should close the channel when an envelope is malformed", func() {
+			messages, err := streamer.Stream(endpoint, "bearer some-token", "some-app-guid", false, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			mockDopplerServer.Send([]byte{0x12, 0x05, 0x01})
+			Eventually(messages).Should(BeClosed())
+		})
+
+		Context("with an invalid token", func() {
+			It("should return an error", func() {
+				_, err := streamer.Stream(endpoint, "bearer some-invalid-token", "some-app-guid", false, stop)
+				Expect(err).To(MatchError(ContainSubstring("401 Unauthorized")))
+			})
+		})
+
+		Context("with an unsupported endpoint", func() {
+			It("should return an error", func() {
+				_, err := streamer.Stream("https://doppler.example.com", "bearer some-token", "some-app-guid", false, stop)
+				Expect(err).To(MatchError("unsupported endpoint: https://doppler.example.com"))
+			})
+		})
+	})
+})
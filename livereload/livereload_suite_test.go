@@ -0,0 +1,13 @@
+package livereload_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestLiveReload(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LiveReload Suite")
+}
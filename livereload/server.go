@@ -0,0 +1,220 @@
+package livereload
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/cf-watch/websocket"
+)
+
+// protocol is the version of the LiveReload protocol that is spoken.
+const protocol = "http://livereload.com/protocols/official-7"
+
+// writeTimeout bounds each message sent to a browser. Browsers that do not
+// take it in time are dropped, so that one that stopped reading cannot hold
+// up reloads.
+const writeTimeout = time.Second
+
+// Server notifies browsers that connect with the LiveReload protocol, either
+// through a LiveReload browser extension or the script it serves at
+// /livereload.js.
+type Server struct {
+	server *http.Server
+
+	// conns holds the open connections, and whether each has said hello and
+	// so should be told to reload.
+	lock  sync.Mutex
+	conns map[*websocket.Conn]bool
+}
+
+type command struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS"`
+}
+
+// Listen starts a server on address.
+func Listen(address string) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{conns: map[*websocket.Conn]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livereload", s.handleSocket)
+	mux.HandleFunc("/livereload.js", handleScript)
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+func (s *Server) handleSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	s.lock.Lock()
+	s.conns[conn] = false
+	s.lock.Unlock()
+	defer s.drop(conn)
+
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var received command
+		if json.Unmarshal(message, &received) != nil || received.Command != "hello" {
+			continue
+		}
+		if err := s.send(conn, command{Command: "hello", Protocols: []string{protocol}, ServerName: "cf-watch"}); err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns[conn] = true
+		s.lock.Unlock()
+	}
+}
+
+// Reload tells every connected browser to reload after the paths changed.
+// Stylesheets are reloaded in place when only CSS changed, and the whole
+// page is reloaded otherwise.
+func (s *Server) Reload(paths []string) {
+	commands := []command{{Command: "reload", Path: firstPath(paths)}}
+	if cssOnly(paths) {
+		commands = nil
+		for _, changed := range paths {
+			commands = append(commands, command{Command: "reload", Path: "/" + changed, LiveCSS: true})
+		}
+	}
+
+	s.lock.Lock()
+	var conns []*websocket.Conn
+	for conn, greeted := range s.conns {
+		if greeted {
+			conns = append(conns, conn)
+		}
+	}
+	s.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			for _, c := range commands {
+				if err := s.send(conn, c); err != nil {
+					s.drop(conn)
+					return
+				}
+			}
+		}(conn)
+	}
+	wg.Wait()
+}
+
+func (s *Server) send(conn *websocket.Conn, c command) error {
+	message, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return conn.WriteText(message)
+}
+
+func (s *Server) drop(conn *websocket.Conn) {
+	s.lock.Lock()
+	delete(s.conns, conn)
+	s.lock.Unlock()
+	conn.Close()
+}
+
+// Close stops the server and disconnects every browser.
+func (s *Server) Close() error {
+	err := s.server.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn := range s.conns {
+		conn.WriteClose()
+		conn.Close()
+	}
+	return err
+}
+
+func cssOnly(paths []string) bool {
+	for _, changed := range paths {
+		if !strings.EqualFold(path.Ext(changed), ".css") {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
+
+func firstPath(paths []string) string {
+	if len(paths) == 0 {
+		return "/"
+	}
+	return "/" + paths[0]
+}
+
+func handleScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Write([]byte(script))
+}
+
+// script is a minimal LiveReload client for pages that include it, for
+// browsers without the extension. It reconnects whenever the server goes
+// away, such as between runs of cf watch.
+const script = `(function () {
+  var host = (document.currentScript && document.currentScript.src.match(/^https?:\/\/([^\/]+)/) || [])[1] || location.hostname + ':35729';
+
+  function reloadStylesheets(path) {
+    var name = path.split('/').pop();
+    var links = document.querySelectorAll('link[rel="stylesheet"]');
+    var found = false;
+    for (var i = 0; i < links.length; i++) {
+      var href = links[i].href.split('?')[0];
+      if (href.slice(-name.length) === name) {
+        links[i].href = href + '?livereload=' + Date.now();
+        found = true;
+      }
+    }
+    if (!found) {
+      location.reload();
+    }
+  }
+
+  function connect() {
+    var socket = new WebSocket('ws://' + host + '/livereload');
+    socket.onopen = function () {
+      socket.send(JSON.stringify({command: 'hello', protocols: ['` + protocol + `']}));
+    };
+    socket.onmessage = function (event) {
+      var message = JSON.parse(event.data);
+      if (message.command !== 'reload') {
+        return;
+      }
+      if (message.liveCSS && /\.css$/i.test(message.path)) {
+        reloadStylesheets(message.path);
+      } else {
+        location.reload();
+      }
+    };
+    socket.onclose = function () {
+      setTimeout(connect, 1000);
+    };
+  }
+
+  connect();
+})();
+`
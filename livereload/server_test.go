@@ -0,0 +1,154 @@
+package livereload_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/pivotal-cf/cf-watch/livereload"
+	"github.com/pivotal-cf/cf-watch/websocket"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		server  *Server
+		address string
+	)
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address = listener.Addr().String()
+		Expect(listener.Close()).To(Succeed())
+
+		server, err = Listen(address)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	connect := func() *websocket.Conn {
+		conn, err := websocket.Dial("ws://"+address, "/livereload", nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.WriteText([]byte(`{"command": "hello", "protocols": ["http://livereload.com/protocols/official-7"]}`))).To(Succeed())
+		Expect(read(conn)).To(Equal(map[string]interface{}{
+			"command":    "hello",
+			"protocols":  []interface{}{"http://livereload.com/protocols/official-7"},
+			"serverName": "cf-watch",
+			"liveCSS":    false,
+		}))
+		return conn
+	}
+
+	Describe("#Reload", func() {
+		It("should reload stylesheets in place when only CSS changed", func() {
+			conn := connect()
+			defer conn.Close()
+
+			server.Reload([]string{"css/some-style.css", "some-other-style.CSS"})
+			Expect(read(conn)).To(Equal(map[string]interface{}{"command": "reload", "path": "/css/some-style.css", "liveCSS": true}))
+			Expect(read(conn)).To(Equal(map[string]interface{}{"command": "reload", "path": "/some-other-style.CSS", "liveCSS": true}))
+		})
+
+		It("should reload the page when anything else changed", func() {
+			conn := connect()
+			defer conn.Close()
+			otherConn := connect()
+			defer otherConn.Close()
+
+			server.Reload([]string{"css/some-style.css", "js/some-script.js"})
+			Expect(read(conn)).To(Equal(map[string]interface{}{"command": "reload", "path": "/css/some-style.css", "liveCSS": false}))
+			Expect(read(otherConn)).To(Equal(map[string]interface{}{"command": "reload", "path": "/css/some-style.css", "liveCSS": false}))
+		})
+
+		It("should only notify browsers that said hello", func() {
+			conn, err := websocket.Dial("ws://"+address, "/livereload", nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			greeted := connect()
+			defer greeted.Close()
+
+			server.Reload([]string{"index.html"})
+			Expect(read(greeted)).To(HaveKeyWithValue("command", "reload"))
+
+			Expect(server.Close()).To(Succeed())
+			_, err = conn.ReadMessage()
+			Expect(err).To(Equal(io.EOF))
+		})
+
+		It("should skip browsers that disconnected", func() {
+			conn := connect()
+			Expect(conn.Close()).To(Succeed())
+			otherConn := connect()
+			defer otherConn.Close()
+
+			server.Reload([]string{"index.html"})
+			server.Reload([]string{"index.html"})
+			Expect(read(otherConn)).To(HaveKeyWithValue("command", "reload"))
+			Expect(read(otherConn)).To(HaveKeyWithValue("command", "reload"))
+		})
+
+		It("should drop browsers that stop reading", func() {
+			conn := connect()
+			defer conn.Close()
+
+			var paths []string
+			for i := 0; i < 1000; i++ {
+				paths = append(paths, "css/"+strings.Repeat("x", 1000)+".css")
+			}
+			done := make(chan struct{})
+			go func() {
+				for i := 0; i < 20; i++ {
+					server.Reload(paths)
+				}
+				close(done)
+			}()
+			Eventually(done, 10*time.Second).Should(BeClosed())
+
+			var err error
+			for err == nil {
+				_, err = conn.ReadMessage()
+			}
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("#Close", func() {
+		It("should disconnect browsers and stop listening", func() {
+			conn := connect()
+			defer conn.Close()
+
+			Expect(server.Close()).To(Succeed())
+			_, err := conn.ReadMessage()
+			Expect(err).To(Equal(io.EOF))
+			_, err = net.Dial("tcp", address)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should serve a LiveReload client script", func() {
+		response, err := http.Get("http://" + address + "/livereload.js")
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+
+		Expect(response.Header.Get("Content-Type")).To(Equal("application/javascript"))
+		Expect(ioutil.ReadAll(response.Body)).To(ContainSubstring("http://livereload.com/protocols/official-7"))
+	})
+})
+
+func read(conn *websocket.Conn) map[string]interface{} {
+	message, err := conn.ReadMessage()
+	Expect(err).NotTo(HaveOccurred())
+	var command map[string]interface{}
+	Expect(json.Unmarshal(message, &command)).To(Succeed())
+	return command
+}
@@ -2,16 +2,41 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/cloudfoundry/cli/cf/terminal"
 	"github.com/cloudfoundry/cli/plugin"
-	"github.com/pivotal-cf/cf-watch/scp"
+	"github.com/pivotal-cf/cf-watch/doppler"
+	"github.com/pivotal-cf/cf-watch/livereload"
+	"github.com/pivotal-cf/cf-watch/transport"
 	"github.com/pivotal-cf/cf-watch/watch"
 )
 
 func main() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
 	plugin.Start(&watch.Plugin{
-		Session: &scp.Session{},
-		UI:      terminal.NewUI(os.Stdin, terminal.NewTeePrinter()),
+		NewSession:  transport.New,
+		UI:          terminal.NewUI(os.Stdin, terminal.NewTeePrinter()),
+		Watcher:     &watch.Poller{Interval: 500 * time.Millisecond},
+		Logs:        &doppler.Streamer{},
+		NewReloader: newReloader,
+		Interrupt:   interrupt,
+		Refresh:     time.Tick(10 * time.Second),
+		After:       time.After,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
 	})
 }
+
+// newReloader starts a LiveReload server, returning a nil watch.Reloader
+// rather than a nil *livereload.Server when it fails to start.
+func newReloader(address string) (watch.Reloader, error) {
+	server, err := livereload.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -61,9 +61,20 @@ var _ = Describe("CF Watch", func() {
 		Eventually(cf("delete-org", "-f", orgName), "10s").Should(gexec.Exit(0))
 	})
 
-	It("should write a `/tmp/watch` file to the app container", func() {
-		Eventually(cf("watch", "test-app", "fixtures/some-dir/some-nested-dir/some-file"), "2s").Should(gexec.Exit(0))
-		session := cf("ssh", "test-app", "-k", "-c", "cat /tmp/watch", "-i", "0")
+	It("should write changed files below `/home/vcap/app` in the app container", func() {
+		dir, err := ioutil.TempDir("", "cf-watch-app")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		watchSession := cf("watch", "test-app", dir)
+		defer watchSession.Interrupt()
+		Eventually(watchSession, "10s").Should(gbytes.Say("Watching"))
+
+		Expect(os.MkdirAll(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file"), []byte("some-text"), 0644)).To(Succeed())
+		Eventually(watchSession, "10s").Should(gbytes.Say(`Synced changes to instance 0: \d+ sent`))
+
+		session := cf("ssh", "test-app", "-k", "-c", "cat /home/vcap/app/some-dir/some-file", "-i", "0")
 		Eventually(session).Should(gexec.Exit(0))
 		Expect(session).To(gbytes.Say("some-text"))
 	})
@@ -0,0 +1,39 @@
+// Package remote holds the types and helpers shared by the watch plugin and
+// the packages that reach the app container and its logs, so that neither
+// depends on the other.
+package remote
+
+import (
+	"strings"
+	"time"
+)
+
+// File describes a regular file below a remote directory. Hash is the
+// hex-encoded SHA-1 of the contents, and is only set when requested.
+type File struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// LogMessage is a line logged by an app or by the platform on its behalf.
+// Source is the source type, such as APP/PROC/WEB or RTR, and Instance the
+// source instance.
+type LogMessage struct {
+	Time     time.Time
+	Source   string
+	Instance string
+	Stderr   bool
+	Message  string
+}
+
+// ShellQuote quotes arg for the shell in the app container, leaving it as is
+// if it only contains characters that the shell does not interpret.
+func ShellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@%+=,", r)
+	}) == -1 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,146 @@
+package scp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// SendArchive copies the listed files and directories, given as
+// slash-separated paths relative to localDir, to the same paths below
+// remoteDir as a gzip-compressed tar stream extracted by a single exec. This
+// avoids the per-file acknowledgements of scp when many files are sent.
+// Parent directories are archived along with each path so that they are
+// created with the modes of their local counterparts.
+func (s *Session) SendArchive(remoteDir, localDir string, paths []string) error {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	for _, relPath := range sorted {
+		if _, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(relPath))); err != nil {
+			return err
+		}
+		if _, err := RemotePath(remoteDir, relPath); err != nil {
+			return err
+		}
+	}
+
+	// Without PreserveTimes, extracted files get the current time, like
+	// files sent by scp without -p.
+	extract := "tar -xzf -"
+	if !s.PreserveTimes {
+		extract += " -m"
+	}
+	command := fmt.Sprintf("mkdir -p -- %[1]s && %[2]s -C %[1]s", remote.ShellQuote(path.Clean(remoteDir)), extract)
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeArchive(writer, localDir, sorted))
+	}()
+	err := s.exec(command, reader, nil)
+	reader.CloseWithError(errors.New("archive not extracted"))
+	return err
+}
+
+func writeArchive(w io.Writer, localDir string, paths []string) error {
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+
+	written := map[string]bool{}
+	for _, relPath := range paths {
+		for _, dir := range parents(relPath) {
+			if written[dir] {
+				continue
+			}
+			if err := writeEntry(archive, localDir, dir); err != nil {
+				return err
+			}
+			written[dir] = true
+		}
+		if written[relPath] {
+			continue
+		}
+		if err := writeEntry(archive, localDir, relPath); err != nil {
+			return err
+		}
+		written[relPath] = true
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+func writeEntry(archive *tar.Writer, localDir, relPath string) error {
+	localPath := filepath.Join(localDir, filepath.FromSlash(relPath))
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    relPath,
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	case info.Mode().IsRegular():
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size()
+	default:
+		return nil
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(archive, file, header.Size)
+	return err
+}
+
+// parents returns the directories above a slash-separated relative path,
+// outermost first.
+func parents(relPath string) []string {
+	var dirs []string
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
+
+// RemoveList deletes the listed files and directories, given as
+// slash-separated paths relative to remoteDir, using a single exec. The paths
+// are passed on stdin rather than as arguments, so any number of them can be
+// removed at once. Directories are removed along with their contents.
+func (s *Session) RemoveList(remoteDir string, paths []string) error {
+	var list bytes.Buffer
+	for _, relPath := range paths {
+		remotePath, err := RemotePath(remoteDir, relPath)
+		if err != nil {
+			return err
+		}
+		list.WriteString(remotePath + "\x00")
+	}
+	return s.exec("xargs -0 -r rm -rf --", &list, nil)
+}
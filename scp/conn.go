@@ -0,0 +1,102 @@
+package scp
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// lostGrace is how long a failed operation waits for its connection to end.
+// The end of a connection is noticed slightly after the operations that fail
+// because of it.
+const lostGrace = 100 * time.Millisecond
+
+// DisconnectedError is returned in place of errors caused by a lost
+// connection to the container. The session must be reconnected, with a new
+// one-time SSH code, before it can be used again.
+type DisconnectedError struct {
+	Err error
+}
+
+func (e *DisconnectedError) Error() string {
+	return "connection lost: " + e.Err.Error()
+}
+
+func (e *DisconnectedError) Disconnected() bool {
+	return true
+}
+
+// Monitor returns a channel that is closed once the connection ends.
+func Monitor(client *ssh.Client) <-chan struct{} {
+	lost := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(lost)
+	}()
+	return lost
+}
+
+// Keepalive sends a keepalive@openssh.com request over the connection every
+// interval until the connection ends. Idle connections are otherwise dropped
+// silently by load balancers, and only noticed when the next operation hangs.
+// Once maxMissed requests in a row go unanswered for an interval, the
+// connection is closed, which ends it for Monitor and every operation.
+func Keepalive(client *ssh.Client, lost <-chan struct{}, interval time.Duration, maxMissed int) {
+	if maxMissed < 1 {
+		maxMissed = 1
+	}
+
+	replies := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		missed := 0
+		for {
+			select {
+			case <-lost:
+				return
+			case <-replies:
+				missed = 0
+			case <-ticker.C:
+				if missed >= maxMissed {
+					client.Close()
+					return
+				}
+				missed++
+				go func() {
+					// Any reply shows that the connection is alive, even if
+					// the server does not know the request.
+					if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+						return
+					}
+					select {
+					case replies <- struct{}{}:
+					case <-lost:
+					}
+				}()
+			}
+		}
+	}()
+}
+
+// CheckConnection returns err as a *DisconnectedError if the connection
+// monitored by lost has ended, or ends shortly after the error. Errors
+// reported by the container, which tell whether they are fatal, are returned
+// as they are.
+func CheckConnection(lost <-chan struct{}, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(interface {
+		Fatal() bool
+	}); ok {
+		return err
+	}
+	select {
+	case <-lost:
+		return &DisconnectedError{Err: err}
+	case <-time.After(lostGrace):
+		return err
+	}
+}
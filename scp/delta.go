@@ -0,0 +1,274 @@
+package scp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+const (
+	minBlockSize = 4 * 1024
+	maxBlockSize = 128 * 1024
+
+	// maxDeltaOps keeps the command that applies a delta well below the
+	// argument length limit of the remote shell.
+	maxDeltaOps = 1000
+
+	// deltaOpCost approximates the bytes added to the command by each
+	// operation, when comparing a delta with the full file.
+	deltaOpCost = 64
+)
+
+// SendDeltas sends each listed regular file of at least DeltaMinSize bytes
+// that also exists remotely as the difference from its remote copy, like
+// rsync. The remote file is split into blocks, which are identified by a
+// rolling checksum and an MD5 computed by standard tools in one exec, and the
+// local file is rebuilt remotely from those blocks and the bytes that no
+// block matches. SendDeltas returns the paths that it did not send, either
+// because they are not eligible, because sending them in full is cheaper, or
+// because the delta could not be computed or applied.
+func (s *Session) SendDeltas(remoteDir, localDir string, paths []string) []string {
+	if s.DeltaMinSize <= 0 {
+		return paths
+	}
+
+	var rest []string
+	for _, relPath := range paths {
+		localPath := filepath.Join(localDir, filepath.FromSlash(relPath))
+		info, err := os.Stat(localPath)
+		if err != nil || !info.Mode().IsRegular() || info.Size() < s.DeltaMinSize {
+			rest = append(rest, relPath)
+			continue
+		}
+		remotePath, err := RemotePath(remoteDir, relPath)
+		if err != nil {
+			rest = append(rest, relPath)
+			continue
+		}
+		if sent, err := s.sendDelta(remotePath, localPath, info); err != nil || !sent {
+			rest = append(rest, relPath)
+		}
+	}
+	return rest
+}
+
+func (s *Session) sendDelta(remotePath, localPath string, info os.FileInfo) (bool, error) {
+	local, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return false, err
+	}
+
+	size := blockSize(int64(len(local)))
+	blocks, err := s.blockSums(remotePath, size)
+	if err != nil || blocks == nil {
+		return false, err
+	}
+
+	ops, literal := delta(local, blocks, size)
+	if len(ops) > maxDeltaOps || literal+int64(len(ops))*deltaOpCost >= int64(len(local)) {
+		return false, nil
+	}
+	return true, s.applyDelta(remotePath, local, info, ops, size)
+}
+
+// blockSize grows with the square root of the file size, like rsync, so that
+// large files are not described by too many blocks.
+func blockSize(size int64) int {
+	block := int(math.Ceil(math.Sqrt(float64(size))/1024)) * 1024
+	if block < minBlockSize {
+		return minBlockSize
+	}
+	if block > maxBlockSize {
+		return maxBlockSize
+	}
+	return block
+}
+
+type blockSum struct {
+	weak   uint32
+	strong string
+	full   bool
+}
+
+// blockSums returns the checksums of every block of the remote file, or nil
+// if it does not exist. The rolling checksum is computed by awk from the
+// decimal bytes printed by od, since no checksum tool provides it.
+func (s *Session) blockSums(remotePath string, size int) ([]blockSum, error) {
+	command := fmt.Sprintf(
+		`f=%s; [ -f "$f" ] || exit 0; stat -c %%s -- "$f" && `+
+			`od -An -v -tu1 -w16 -- "$f" | awk '{for(i=1;i<=NF;i++){a+=$i;b+=a};n+=NF} n==%[2]d{print a%%65536,b%%65536;a=b=n=0} END{if(n)print a%%65536,b%%65536}' && `+
+			`split -b %[2]d --filter=md5sum -- "$f"`,
+		remote.ShellQuote(remotePath), size,
+	)
+
+	var stdout bytes.Buffer
+	if err := s.exec(command, nil, &stdout); err != nil {
+		return nil, err
+	}
+	if stdout.Len() == 0 {
+		return nil, nil
+	}
+	return parseBlockSums(stdout.String(), size)
+}
+
+func parseBlockSums(output string, size int) ([]blockSum, error) {
+	invalid := fmt.Errorf("invalid block checksums: %q", output)
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	fileSize, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	count := int((fileSize + int64(size) - 1) / int64(size))
+	if len(lines) != 1+2*count {
+		return nil, invalid
+	}
+
+	blocks := make([]blockSum, count)
+	for i := range blocks {
+		var a, b uint32
+		if _, err := fmt.Sscanf(lines[1+i], "%d %d", &a, &b); err != nil {
+			return nil, invalid
+		}
+		fields := strings.Fields(lines[1+count+i])
+		if len(fields) != 2 || len(fields[0]) != 2*md5.Size {
+			return nil, invalid
+		}
+		full := int64(i+1)*int64(size) <= fileSize
+		blocks[i] = blockSum{weak: a | b<<16, strong: fields[0], full: full}
+	}
+	return blocks, nil
+}
+
+// deltaOp either copies count blocks from the remote file, starting with
+// block, or sends literal bytes.
+type deltaOp struct {
+	block   int
+	count   int
+	literal []byte
+}
+
+// delta finds the blocks of the remote file in the local file at any offset,
+// using the rolling checksum to find candidates and MD5 to confirm them. It
+// returns the operations that rebuild the local file and the number of
+// literal bytes among them. Only full blocks are matched.
+func delta(local []byte, blocks []blockSum, size int) ([]deltaOp, int64) {
+	candidates := map[uint32][]int{}
+	for i, block := range blocks {
+		if block.full {
+			candidates[block.weak] = append(candidates[block.weak], i)
+		}
+	}
+
+	var ops []deltaOp
+	var literal int64
+	start := 0
+	emit := func(end int) {
+		if end > start {
+			ops = append(ops, deltaOp{literal: local[start:end]})
+			literal += int64(end - start)
+		}
+	}
+
+	offset := 0
+	var a, b uint32
+	rolling := false
+	for offset+size <= len(local) {
+		if !rolling {
+			a, b = weakSum(local[offset : offset+size])
+			rolling = true
+		}
+
+		if matches, ok := candidates[a|b<<16]; ok {
+			sum := md5.Sum(local[offset : offset+size])
+			strong := hex.EncodeToString(sum[:])
+			if block := find(matches, blocks, strong); block >= 0 {
+				emit(offset)
+				if n := len(ops); n > 0 && ops[n-1].literal == nil && ops[n-1].block+ops[n-1].count == block {
+					ops[n-1].count++
+				} else {
+					ops = append(ops, deltaOp{block: block, count: 1})
+				}
+				offset += size
+				start = offset
+				rolling = false
+				continue
+			}
+		}
+
+		if offset+size == len(local) {
+			break
+		}
+		out, in := uint32(local[offset]), uint32(local[offset+size])
+		a = (a - out + in) & 0xffff
+		b = (b - uint32(size)*out + a) & 0xffff
+		offset++
+	}
+
+	emit(len(local))
+	return ops, literal
+}
+
+func find(matches []int, blocks []blockSum, strong string) int {
+	for _, i := range matches {
+		if blocks[i].strong == strong {
+			return i
+		}
+	}
+	return -1
+}
+
+// weakSum is the rsync rolling checksum: the sum of the bytes, and the sum of
+// the running sums, each modulo 2^16.
+func weakSum(data []byte) (uint32, uint32) {
+	var a, b uint32
+	for _, x := range data {
+		a += uint32(x)
+		b += a
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+// applyDelta rebuilds the file next to the remote copy from its blocks and
+// the literal bytes, which are read from stdin, and replaces the remote copy
+// only if the result has the MD5 of the local file.
+func (s *Session) applyDelta(remotePath string, local []byte, info os.FileInfo, ops []deltaOp, size int) error {
+	var steps []string
+	var literals []io.Reader
+	for _, op := range ops {
+		if op.literal != nil {
+			steps = append(steps, fmt.Sprintf("head -c %d", len(op.literal)))
+			literals = append(literals, bytes.NewReader(op.literal))
+			continue
+		}
+		steps = append(steps, fmt.Sprintf(`dd if="$f" bs=%d skip=%d count=%d status=none`, size, op.block, op.count))
+	}
+
+	sum := md5.Sum(local)
+	finish := fmt.Sprintf("chmod %04o -- \"$t\"", info.Mode().Perm())
+	if s.PreserveTimes {
+		finish += fmt.Sprintf(" && touch -d @%d -- \"$t\"", info.ModTime().Unix())
+	}
+	command := fmt.Sprintf(
+		`f=%s; t=$(mktemp -- %s) || exit 1; `+
+			`if { %s; } > "$t" && echo "%s  $t" | md5sum -c --status && %s && mv -f -- "$t" "$f"; then exit 0; fi; rm -f -- "$t"; exit 1`,
+		remote.ShellQuote(remotePath),
+		remote.ShellQuote(path.Join(path.Dir(remotePath), ".cf-watch-XXXXXX")),
+		strings.Join(steps, "; "),
+		hex.EncodeToString(sum[:]),
+		finish,
+	)
+
+	return s.exec(command, io.MultiReader(literals...), nil)
+}
@@ -0,0 +1,148 @@
+package scp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// Remove deletes the listed files and directories, given as slash-separated
+// paths relative to remoteDir, using a single exec. Directories are removed
+// along with their contents.
+func (s *Session) Remove(remoteDir string, paths []string) error {
+	args := []string{"rm", "-rf", "--"}
+	for _, relPath := range paths {
+		remotePath, err := RemotePath(remoteDir, relPath)
+		if err != nil {
+			return err
+		}
+		args = append(args, remote.ShellQuote(remotePath))
+	}
+	return s.exec(strings.Join(args, " "), nil, nil)
+}
+
+// Rename moves a file or directory below remoteDir, replacing anything that
+// already exists at the new path and creating its parent directories.
+func (s *Session) Rename(remoteDir, oldPath, newPath string) error {
+	oldRemotePath, err := RemotePath(remoteDir, oldPath)
+	if err != nil {
+		return err
+	}
+	newRemotePath, err := RemotePath(remoteDir, newPath)
+	if err != nil {
+		return err
+	}
+
+	return s.exec(fmt.Sprintf("mkdir -p -- %s && rm -rf -- %s && mv -f -- %s %s",
+		remote.ShellQuote(path.Dir(newRemotePath)),
+		remote.ShellQuote(newRemotePath),
+		remote.ShellQuote(oldRemotePath),
+		remote.ShellQuote(newRemotePath),
+	), nil, nil)
+}
+
+// Run runs a shell command in remoteDir using a new exec on the session's
+// connection, streaming its output to stdout and stderr. A non-zero exit
+// status is returned as an *ssh.ExitError.
+func (s *Session) Run(remoteDir, command string, stdout, stderr io.Writer) error {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	return CheckConnection(s.lost, RunCommand(s.client, remoteDir, command, stdout, stderr))
+}
+
+// RunCommand runs a shell command in remoteDir over client, for sessions that
+// share a connection established by Dial.
+func RunCommand(client *ssh.Client, remoteDir, command string, stdout, stderr io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(fmt.Sprintf("cd -- %s || exit; %s", remote.ShellQuote(path.Clean(remoteDir)), command))
+}
+
+// Dial opens a TCP connection from the container to address, over a
+// direct-tcpip channel on the session's connection. Unlike other methods, it
+// may be called while the session is being closed.
+func (s *Session) Dial(address string) (net.Conn, error) {
+	s.lock.Lock()
+	client, lost := s.client, s.lost
+	s.lock.Unlock()
+	if client == nil {
+		return nil, errors.New("session closed")
+	}
+	conn, err := client.Dial("tcp", address)
+	if err != nil {
+		return nil, CheckConnection(lost, err)
+	}
+	return conn, nil
+}
+
+// PathError is returned for paths that would resolve outside of the remote
+// directory, which are never modified.
+type PathError struct {
+	RemoteDir string
+	Path      string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("refusing to modify %s outside of %s", e.Path, e.RemoteDir)
+}
+
+// RemotePath joins a slash-separated path to remoteDir, ensuring that the
+// result is strictly below remoteDir and that remoteDir is not the root.
+func RemotePath(remoteDir, relPath string) (string, error) {
+	remoteDir = path.Clean(remoteDir)
+	if !path.IsAbs(remoteDir) || remoteDir == "/" {
+		return "", &PathError{RemoteDir: remoteDir, Path: relPath}
+	}
+	if path.IsAbs(relPath) {
+		return "", &PathError{RemoteDir: remoteDir, Path: relPath}
+	}
+	joined := path.Join(remoteDir, relPath)
+	if !strings.HasPrefix(joined, remoteDir+"/") {
+		return "", &PathError{RemoteDir: remoteDir, Path: relPath}
+	}
+	return joined, nil
+}
+
+// exec runs a remote command, returning its error output if it fails. Errors
+// caused by a lost connection are returned as a *DisconnectedError.
+func (s *Session) exec(command string, stdin io.Reader, stdout io.Writer) error {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	return CheckConnection(s.lost, s.run(command, stdin, stdout))
+}
+
+func (s *Session) run(command string, stdin io.Reader, stdout io.Writer) error {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	if err := session.Run(command); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return errors.New(message)
+		}
+		return err
+	}
+	return nil
+}
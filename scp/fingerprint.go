@@ -0,0 +1,70 @@
+package scp
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyError is returned when the SSH endpoint presents a host key that
+// does not match the expected fingerprint.
+type HostKeyError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("host key fingerprint mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
+
+// verifyHostKey returns a host key callback that accepts only keys matching
+// the provided fingerprint. MD5 fingerprints are colon-separated hex, and
+// SHA-256 fingerprints are unpadded base64 with an optional "SHA256:" prefix.
+func verifyHostKey(fingerprint string) (func(string, net.Addr, ssh.PublicKey) error, error) {
+	expected := strings.TrimSpace(fingerprint)
+	var actual func(key ssh.PublicKey) string
+
+	switch {
+	case strings.HasPrefix(expected, "SHA256:"):
+		actual = func(key ssh.PublicKey) string {
+			return "SHA256:" + sha256Fingerprint(key)
+		}
+	case strings.HasPrefix(strings.ToUpper(expected), "MD5:"):
+		expected = strings.ToLower(expected[len("MD5:"):])
+		actual = md5Fingerprint
+	case len(expected) == 47:
+		expected = strings.ToLower(expected)
+		actual = md5Fingerprint
+	case len(strings.TrimRight(expected, "=")) == 43:
+		expected = strings.TrimRight(expected, "=")
+		actual = sha256Fingerprint
+	default:
+		return nil, fmt.Errorf("unsupported host key fingerprint: %s", fingerprint)
+	}
+
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if fingerprint := actual(key); fingerprint != expected {
+			return &HostKeyError{Expected: expected, Actual: fingerprint}
+		}
+		return nil
+	}, nil
+}
+
+func md5Fingerprint(key ssh.PublicKey) string {
+	sum := md5.Sum(key.Marshal())
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+func sha256Fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return base64.RawStdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,87 @@
+package scp
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// List returns the regular files below remoteDir, keyed by slash-separated
+// paths relative to remoteDir, using a single exec. When checksum is set, the
+// SHA-1 of every file is listed as well. A missing remoteDir has no files.
+func (s *Session) List(remoteDir string, checksum bool) (map[string]remote.File, error) {
+	if !path.IsAbs(remoteDir) {
+		return nil, fmt.Errorf("remote directory must be absolute: %s", remoteDir)
+	}
+
+	// Records are NUL-terminated so that any file name can be parsed. The
+	// checksums follow the listing after an empty record, one per line, since
+	// older versions of sha1sum cannot terminate them with NUL. Names that
+	// contain a newline or backslash are escaped by sha1sum instead.
+	list := `find . -type f -printf '%s %T@ %P\0'`
+	if checksum {
+		list += ` && printf '\0' && find . -type f -exec sha1sum -- {} +`
+	}
+	command := fmt.Sprintf("if [ -d %[1]s ]; then cd %[1]s && %[2]s; fi", remote.ShellQuote(remoteDir), list)
+
+	var stdout bytes.Buffer
+	if err := s.exec(command, nil, &stdout); err != nil {
+		return nil, err
+	}
+	return parseList(stdout.String())
+}
+
+// checksumUnescaper reverses the escaping of names in sha1sum output.
+var checksumUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+
+func parseList(output string) (map[string]remote.File, error) {
+	files := map[string]remote.File{}
+	records := strings.Split(output, "\x00")
+
+	i := 0
+	for ; i < len(records) && records[i] != ""; i++ {
+		fields := strings.SplitN(records[i], " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid file listing: %q", records[i])
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file listing: %q", records[i])
+		}
+		seconds, err := strconv.ParseInt(strings.SplitN(fields[1], ".", 2)[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file listing: %q", records[i])
+		}
+		files[fields[2]] = remote.File{Size: size, ModTime: time.Unix(seconds, 0)}
+	}
+
+	if i >= len(records) {
+		return files, nil
+	}
+	for _, line := range strings.Split(strings.Join(records[i+1:], "\x00"), "\n") {
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		fields := strings.SplitN(strings.TrimPrefix(line, "\\"), "  ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid checksum listing: %q", line)
+		}
+		relPath := strings.TrimPrefix(fields[1], "./")
+		if escaped {
+			relPath = checksumUnescaper.Replace(relPath)
+		}
+		file, ok := files[relPath]
+		if !ok {
+			continue
+		}
+		file.Hash = fields[0]
+		files[relPath] = file
+	}
+	return files, nil
+}
@@ -0,0 +1,405 @@
+package mocks
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var errShortPacket = errors.New("short sftp packet")
+
+// startSFTP serves SFTP on channel in a goroutine that Stop closes and waits
+// for, so that its error is only checked on the test goroutine.
+func (s *SSHServer) startSFTP(channel ssh.Channel) {
+	s.sftpLock.Lock()
+	defer s.sftpLock.Unlock()
+	s.sftpChannels = append(s.sftpChannels, channel)
+	s.sftpWait.Add(1)
+	go func() {
+		defer s.sftpWait.Done()
+		if err := s.serveSFTP(channel); err != nil {
+			s.sftpLock.Lock()
+			if s.sftpErr == nil {
+				s.sftpErr = err
+			}
+			s.sftpLock.Unlock()
+		}
+	}()
+}
+
+// stopSFTP closes every SFTP channel, waits for their goroutines to exit and
+// returns the first error that any of them encountered.
+func (s *SSHServer) stopSFTP() error {
+	s.sftpLock.Lock()
+	for _, channel := range s.sftpChannels {
+		channel.Close()
+	}
+	s.sftpChannels = nil
+	s.sftpLock.Unlock()
+
+	s.sftpWait.Wait()
+
+	s.sftpLock.Lock()
+	defer s.sftpLock.Unlock()
+	err := s.sftpErr
+	s.sftpErr = nil
+	return err
+}
+
+// serveSFTP answers version 3 SFTP requests on channel, mapping every remote
+// path below SFTPRoot. Paths listed in SFTPDenied cannot be opened or created,
+// and the names in SFTPEntries are listed as empty files in their directories
+// in addition to the real entries.
+// It returns once the channel is closed, or with an error if a request is
+// malformed or a reply cannot be written.
+func (s *SSHServer) serveSFTP(channel ssh.Channel) error {
+	defer channel.Close()
+
+	server := &sftpServer{root: s.SFTPRoot, denied: s.SFTPDenied, entries: s.SFTPEntries, channel: channel, handles: map[string]*sftpHandle{}}
+	reader := bufio.NewReader(channel)
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			return errShortPacket
+		}
+		request := &sftpRequest{buf: body[1:]}
+		if err := server.handle(body[0], request); err != nil {
+			return err
+		}
+		if request.err != nil {
+			return request.err
+		}
+	}
+}
+
+type sftpServer struct {
+	root       string
+	denied     map[string]bool
+	entries    map[string][]string
+	channel    ssh.Channel
+	handles    map[string]*sftpHandle
+	nextHandle int
+}
+
+type sftpHandle struct {
+	file    *os.File
+	entries []os.FileInfo
+	listed  bool
+}
+
+func (s *sftpServer) local(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+func (s *sftpServer) handle(typ byte, request *sftpRequest) error {
+	if typ == 1 {
+		if version := request.uint32(); version != 3 {
+			return fmt.Errorf("unexpected sftp version %d", version)
+		}
+		return s.reply(2, func(p *sftpResponse) { p.uint32(3) })
+	}
+
+	id := request.uint32()
+	if request.err != nil {
+		return request.err
+	}
+	switch typ {
+	case 3:
+		name := request.string()
+		flags := request.uint32()
+		attrs := request.attrs()
+		if s.denied[name] {
+			return s.status(id, 3, "permission denied")
+		}
+		osFlags := os.O_RDONLY
+		if flags&0x02 != 0 {
+			osFlags = os.O_WRONLY
+		}
+		if flags&0x08 != 0 {
+			osFlags |= os.O_CREATE
+		}
+		if flags&0x10 != 0 {
+			osFlags |= os.O_TRUNC
+		}
+		file, err := os.OpenFile(s.local(name), osFlags, os.FileMode(attrs.permissions&0777))
+		if err != nil {
+			return s.error(id, err)
+		}
+		return s.handleReply(id, &sftpHandle{file: file})
+	case 4:
+		handle := request.string()
+		if h := s.handles[handle]; h != nil && h.file != nil {
+			h.file.Close()
+		}
+		delete(s.handles, handle)
+		return s.status(id, 0, "")
+	case 5:
+		h := s.handles[request.string()]
+		offset := request.uint64()
+		data := make([]byte, request.uint32())
+		if h == nil || h.file == nil {
+			return s.status(id, 4, "invalid handle")
+		}
+		n, err := h.file.ReadAt(data, int64(offset))
+		if n == 0 && err == io.EOF {
+			return s.status(id, 1, "EOF")
+		}
+		return s.reply(103, func(p *sftpResponse) {
+			p.uint32(id)
+			p.string(string(data[:n]))
+		})
+	case 6:
+		h := s.handles[request.string()]
+		offset := request.uint64()
+		data := request.string()
+		if h == nil || h.file == nil {
+			return s.status(id, 4, "invalid handle")
+		}
+		if _, err := h.file.WriteAt([]byte(data), int64(offset)); err != nil {
+			return err
+		}
+		return s.status(id, 0, "")
+	case 7, 17:
+		name := request.string()
+		stat := os.Stat
+		if typ == 7 {
+			stat = os.Lstat
+		}
+		info, err := stat(s.local(name))
+		if err != nil {
+			return s.error(id, err)
+		}
+		return s.reply(105, func(p *sftpResponse) {
+			p.uint32(id)
+			p.attrs(info)
+		})
+	case 9:
+		name := s.local(request.string())
+		attrs := request.attrs()
+		if attrs.flags&0x04 != 0 {
+			if err := os.Chmod(name, os.FileMode(attrs.permissions&0777)); err != nil {
+				return err
+			}
+		}
+		if attrs.flags&0x08 != 0 {
+			if err := os.Chtimes(name, time.Unix(int64(attrs.atime), 0), time.Unix(int64(attrs.mtime), 0)); err != nil {
+				return err
+			}
+		}
+		return s.status(id, 0, "")
+	case 11:
+		name := request.string()
+		entries, err := ioutil.ReadDir(s.local(name))
+		if err != nil {
+			return s.error(id, err)
+		}
+		for _, extra := range s.entries[name] {
+			entries = append(entries, sftpEntry(extra))
+		}
+		return s.handleReply(id, &sftpHandle{entries: entries})
+	case 12:
+		h := s.handles[request.string()]
+		if h == nil {
+			return s.status(id, 4, "invalid handle")
+		}
+		if h.listed {
+			return s.status(id, 1, "EOF")
+		}
+		h.listed = true
+		return s.reply(104, func(p *sftpResponse) {
+			p.uint32(id)
+			p.uint32(uint32(len(h.entries)))
+			for _, entry := range h.entries {
+				p.string(entry.Name())
+				p.string(entry.Name())
+				p.attrs(entry)
+			}
+		})
+	case 13:
+		return s.result(id, os.Remove(s.local(request.string())))
+	case 14:
+		name := request.string()
+		attrs := request.attrs()
+		if s.denied[name] {
+			return s.status(id, 3, "permission denied")
+		}
+		return s.result(id, os.Mkdir(s.local(name), os.FileMode(attrs.permissions&0777)))
+	case 15:
+		return s.result(id, os.Remove(s.local(request.string())))
+	case 18:
+		oldPath := s.local(request.string())
+		newPath := s.local(request.string())
+		if _, err := os.Lstat(newPath); err == nil {
+			return s.status(id, 4, "file exists")
+		}
+		return s.result(id, os.Rename(oldPath, newPath))
+	default:
+		return s.status(id, 8, "unsupported request type "+strconv.Itoa(int(typ)))
+	}
+}
+
+func (s *sftpServer) handleReply(id uint32, h *sftpHandle) error {
+	s.nextHandle++
+	handle := strconv.Itoa(s.nextHandle)
+	s.handles[handle] = h
+	return s.reply(102, func(p *sftpResponse) {
+		p.uint32(id)
+		p.string(handle)
+	})
+}
+
+func (s *sftpServer) result(id uint32, err error) error {
+	if err != nil {
+		return s.error(id, err)
+	}
+	return s.status(id, 0, "")
+}
+
+func (s *sftpServer) error(id uint32, err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return s.status(id, 2, "no such file")
+	case os.IsPermission(err):
+		return s.status(id, 3, "permission denied")
+	default:
+		return s.status(id, 4, err.Error())
+	}
+}
+
+func (s *sftpServer) status(id, code uint32, message string) error {
+	return s.reply(101, func(p *sftpResponse) {
+		p.uint32(id)
+		p.uint32(code)
+		p.string(message)
+		p.string("")
+	})
+}
+
+// reply writes a response. A write that fails because the client has already
+// closed the channel is not an error of the server.
+func (s *sftpServer) reply(typ byte, build func(p *sftpResponse)) error {
+	response := &sftpResponse{buf: []byte{0, 0, 0, 0, typ}}
+	build(response)
+	binary.BigEndian.PutUint32(response.buf, uint32(len(response.buf)-4))
+	if _, err := s.channel.Write(response.buf); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// sftpEntry is an empty file that is only listed, with any name.
+type sftpEntry string
+
+func (e sftpEntry) Name() string       { return string(e) }
+func (e sftpEntry) Size() int64        { return 0 }
+func (e sftpEntry) Mode() os.FileMode  { return 0644 }
+func (e sftpEntry) ModTime() time.Time { return time.Unix(0, 0) }
+func (e sftpEntry) IsDir() bool        { return false }
+func (e sftpEntry) Sys() interface{}   { return nil }
+
+type sftpAttrs struct {
+	flags       uint32
+	permissions uint32
+	atime       uint32
+	mtime       uint32
+}
+
+// sftpRequest decodes the fields of a request. Reading past its end sets err
+// and returns zero values.
+type sftpRequest struct {
+	buf []byte
+	err error
+}
+
+func (r *sftpRequest) uint32() uint32 {
+	if len(r.buf) < 4 {
+		r.err = errShortPacket
+		r.buf = nil
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *sftpRequest) uint64() uint64 {
+	return uint64(r.uint32())<<32 | uint64(r.uint32())
+}
+
+func (r *sftpRequest) string() string {
+	length := r.uint32()
+	if uint32(len(r.buf)) < length {
+		r.err = errShortPacket
+		r.buf = nil
+		return ""
+	}
+	s := string(r.buf[:length])
+	r.buf = r.buf[length:]
+	return s
+}
+
+func (r *sftpRequest) attrs() sftpAttrs {
+	attrs := sftpAttrs{flags: r.uint32()}
+	if attrs.flags&0x01 != 0 {
+		r.uint64()
+	}
+	if attrs.flags&0x02 != 0 {
+		r.uint64()
+	}
+	if attrs.flags&0x04 != 0 {
+		attrs.permissions = r.uint32()
+	}
+	if attrs.flags&0x08 != 0 {
+		attrs.atime = r.uint32()
+		attrs.mtime = r.uint32()
+	}
+	return attrs
+}
+
+type sftpResponse struct {
+	buf []byte
+}
+
+func (p *sftpResponse) uint32(v uint32) {
+	p.buf = append(p.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (p *sftpResponse) string(s string) {
+	p.uint32(uint32(len(s)))
+	p.buf = append(p.buf, s...)
+}
+
+func (p *sftpResponse) attrs(info os.FileInfo) {
+	permissions := uint32(info.Mode().Perm())
+	switch {
+	case info.IsDir():
+		permissions |= 0040000
+	case info.Mode()&os.ModeSymlink != 0:
+		permissions |= 0120000
+	case info.Mode().IsRegular():
+		permissions |= 0100000
+	}
+	p.uint32(0x01 | 0x04 | 0x08)
+	size := uint64(info.Size())
+	p.uint32(uint32(size >> 32))
+	p.uint32(uint32(size))
+	p.uint32(permissions)
+	p.uint32(uint32(info.ModTime().Unix()))
+	p.uint32(uint32(info.ModTime().Unix()))
+}
@@ -1,10 +1,18 @@
 package mocks
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,10 +25,35 @@ type SSHServer struct {
 	Password          string
 	CommandChan       chan string
 	CommandExitStatus byte
+	CommandStdout     string
+	CommandStderr     string
 	RejectSession     bool
+	SCPWarnings       map[string]string
+	SCPError          string
+	SFTPRoot          string
+	SFTPDenied        map[string]bool
+	SFTPEntries       map[string][]string
+	Exec              func(command string, stdin io.Reader, stdout, stderr io.Writer) (exitStatus byte)
+	IgnoreKeepalives  bool
+	Keepalives        chan struct{}
 	Data              *gbytes.Buffer
 	listener          net.Listener
 	closeChan         chan struct{}
+	entriesLock       sync.Mutex
+	entries           []SCPEntry
+	sftpLock          sync.Mutex
+	sftpWait          sync.WaitGroup
+	sftpChannels      []ssh.Channel
+	sftpErr           error
+}
+
+// SCPEntry is a file or directory record received by the scp sink.
+type SCPEntry struct {
+	Path     string
+	Mode     os.FileMode
+	Dir      bool
+	Contents string
+	ModTime  time.Time
 }
 
 func (s *SSHServer) Start() (address string) {
@@ -32,7 +65,9 @@ func (s *SSHServer) Start() (address string) {
 	s.closeChan = make(chan struct{})
 
 	s.CommandChan = make(chan string)
+	s.Keepalives = make(chan struct{}, 100)
 	s.Data = gbytes.NewBuffer()
+	s.entries = nil
 
 	go s.listen()
 
@@ -46,6 +81,7 @@ func (s *SSHServer) Stop() {
 	Expect(s.listener.Close()).To(Succeed())
 	<-s.closeChan
 	s.listener = nil
+	Expect(s.stopSFTP()).To(Succeed(), "sftp server failed")
 }
 
 func (s *SSHServer) listen() {
@@ -78,7 +114,7 @@ func (s *SSHServer) listen() {
 			return
 		}
 
-		go ssh.DiscardRequests(requests)
+		go s.handleRequests(requests)
 		go func() {
 			for newChannel := range newChannels {
 				go s.handleChannel(newChannel)
@@ -87,9 +123,33 @@ func (s *SSHServer) listen() {
 	}
 }
 
+// handleRequests records keepalive@openssh.com requests on Keepalives, and
+// rejects every global request unless IgnoreKeepalives leaves keepalives
+// unanswered.
+func (s *SSHServer) handleRequests(requests <-chan *ssh.Request) {
+	for request := range requests {
+		if request.Type == "keepalive@openssh.com" {
+			select {
+			case s.Keepalives <- struct{}{}:
+			default:
+			}
+			if s.IgnoreKeepalives {
+				continue
+			}
+		}
+		if request.WantReply {
+			request.Reply(false, nil)
+		}
+	}
+}
+
 func (s *SSHServer) handleChannel(newChannel ssh.NewChannel) {
 	defer GinkgoRecover()
 
+	if newChannel.ChannelType() == "direct-tcpip" {
+		s.handleDirectTCPIP(newChannel)
+		return
+	}
 	Expect(newChannel.ChannelType()).To(Equal("session"))
 
 	if s.RejectSession {
@@ -105,15 +165,58 @@ func (s *SSHServer) handleChannel(newChannel ssh.NewChannel) {
 
 		for request := range requests {
 			switch request.Type {
+			case "subsystem":
+				if s.SFTPRoot == "" || string(request.Payload[4:]) != "sftp" {
+					Expect(request.Reply(false, nil)).To(Succeed())
+					continue
+				}
+				Expect(request.Reply(true, nil)).To(Succeed())
+				s.startSFTP(channel)
 			case "exec":
 				payloadLen := binary.BigEndian.Uint32(request.Payload[:4])
 				Expect(request.Payload).To(HaveLen(int(payloadLen) + 4))
+				command := string(request.Payload[4:])
 
-				s.CommandChan <- string(request.Payload[4:])
+				if s.Exec != nil {
+					Expect(request.Reply(true, nil)).To(Succeed())
+					exitStatus := s.Exec(command, channel, channel, channel.Stderr())
+					_, err := channel.SendRequest("exit-status", false, []byte{0, 0, 0, exitStatus})
+					Expect(err).To(Succeed())
+					channel.Close()
+					break
+				}
+
+				exitStatus := s.CommandExitStatus
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+
+					if strings.Contains(command, "/usr/bin/scp -t") && s.CommandExitStatus == 0 {
+						fields := strings.Fields(command)
+						exitStatus = s.sink(channel, fields[len(fields)-1])
+					} else {
+						io.Copy(s.Data, channel)
+					}
+				}()
+
+				s.CommandChan <- command
 
 				Expect(request.Reply(true, nil)).To(Succeed())
 
-				_, err := channel.SendRequest("exit-status", false, []byte{0, 0, 0, s.CommandExitStatus})
+				if s.CommandExitStatus == 0 {
+					<-done
+				}
+				if s.CommandStdout != "" {
+					_, err := channel.Write([]byte(s.CommandStdout))
+					Expect(err).NotTo(HaveOccurred())
+				}
+				if s.CommandStderr != "" {
+					_, err := channel.Stderr().Write([]byte(s.CommandStderr))
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				_, err := channel.SendRequest("exit-status", false, []byte{0, 0, 0, exitStatus})
 				Expect(err).To(Succeed())
 
 				channel.Close()
@@ -121,8 +224,127 @@ func (s *SSHServer) handleChannel(newChannel ssh.NewChannel) {
 			}
 		}
 	}()
+}
+
+// handleDirectTCPIP connects a direct-tcpip channel to the requested address,
+// or rejects it if the address cannot be reached.
+func (s *SSHServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	Expect(ssh.Unmarshal(newChannel.ExtraData(), &target)).To(Succeed())
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		Expect(newChannel.Reject(ssh.ConnectionFailed, err.Error())).To(Succeed())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	Expect(err).NotTo(HaveOccurred())
+	go ssh.DiscardRequests(requests)
+
 	go func() {
-		defer GinkgoRecover()
-		io.Copy(s.Data, channel)
+		io.Copy(channel, conn)
+		channel.CloseWrite()
 	}()
+	io.Copy(conn, channel)
+	conn.(*net.TCPConn).CloseWrite()
+}
+
+// Received returns the entries written by the most recent scp sessions.
+func (s *SSHServer) Received() []SCPEntry {
+	s.entriesLock.Lock()
+	defer s.entriesLock.Unlock()
+	return append([]SCPEntry(nil), s.entries...)
+}
+
+func (s *SSHServer) sink(channel ssh.Channel, target string) (exitStatus byte) {
+	reader := bufio.NewReader(io.TeeReader(channel, s.Data))
+	dirs := []string{target}
+	var modTime time.Time
+	respond := func(entryPath string) bool {
+		var response []byte
+		if s.SCPError != "" {
+			response = []byte("\x02" + s.SCPError + "\n")
+		} else if warning, ok := s.SCPWarnings[entryPath]; ok {
+			response = []byte("\x01" + warning + "\n")
+		} else {
+			response = []byte{0}
+		}
+		_, err := channel.Write(response)
+		Expect(err).NotTo(HaveOccurred())
+
+		if response[0] != 0 {
+			exitStatus = 1
+		}
+		return response[0] == 0
+	}
+
+	_, err := channel.Write([]byte{0})
+	Expect(err).NotTo(HaveOccurred())
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			Expect(line).To(BeEmpty(), "truncated scp record")
+			Expect(dirs).To(HaveLen(1), "unterminated scp directory")
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		line = strings.TrimSuffix(line, "\n")
+
+		switch line[0] {
+		case 'C', 'D':
+			var mode os.FileMode
+			var size int64
+			var name string
+			_, err := fmt.Sscanf(line[1:], "%o %d %s", &mode, &size, &name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).NotTo(ContainSubstring("/"))
+
+			entry := SCPEntry{Path: path.Join(append(dirs, name)...), Mode: mode, ModTime: modTime}
+			modTime = time.Time{}
+			if !respond(entry.Path) {
+				if s.SCPError != "" {
+					io.Copy(ioutil.Discard, reader)
+					return
+				}
+				continue
+			}
+
+			if line[0] == 'D' {
+				entry.Dir = true
+				dirs = append(dirs, name)
+			} else {
+				contents := make([]byte, size)
+				n, err := io.ReadFull(reader, contents)
+				entry.Contents = string(contents[:n])
+				if err == nil {
+					terminator, err := reader.ReadByte()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(terminator).To(BeZero())
+					respond("")
+				}
+			}
+
+			s.entriesLock.Lock()
+			s.entries = append(s.entries, entry)
+			s.entriesLock.Unlock()
+		case 'T':
+			var mtime, atime int64
+			_, err := fmt.Sscanf(line[1:], "%d 0 %d 0", &mtime, &atime)
+			Expect(err).NotTo(HaveOccurred())
+			modTime = time.Unix(mtime, 0)
+			respond("")
+		case 'E':
+			Expect(dirs).NotTo(HaveLen(1), "unbalanced E record")
+			dirs = dirs[:len(dirs)-1]
+			respond("")
+		default:
+			Fail("unexpected scp record: " + line)
+		}
+	}
 }
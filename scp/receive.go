@@ -0,0 +1,285 @@
+package scp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// Receive copies remotePath, a file or a directory, from the container to
+// localPath using a single scp exec in source mode. Modes and modification
+// times are preserved. If localPath is an existing directory, remotePath is
+// copied into it, like scp does. Files that the container cannot read are
+// skipped, and reported by the *RemoteError that is returned once the rest
+// have been copied.
+func (s *Session) Receive(remotePath, localPath string) error {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	return CheckConnection(s.lost, s.receive(remotePath, localPath))
+}
+
+func (s *Session) receive(remotePath, localPath string) error {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := session.Start("/usr/bin/scp -rpf " + remote.ShellQuote(remotePath)); err != nil {
+		return err
+	}
+	sink := &sink{writer: stdin, reader: bufio.NewReader(stdout)}
+	receiveErr := sink.receive(localPath)
+	stdin.Close()
+	waitErr := session.Wait()
+	if receiveErr != nil {
+		return receiveErr
+	}
+	if sink.warning != nil {
+		return sink.warning
+	}
+	return waitErr
+}
+
+// sink speaks the sink side of the scp protocol, acknowledging every record
+// that the remote source sends.
+type sink struct {
+	writer  io.Writer
+	reader  *bufio.Reader
+	warning *RemoteError
+
+	modTime time.Time
+	dirs    []sinkDir
+}
+
+// sinkDir is a directory that is being received. Its mode and modification
+// time are applied once its contents are complete.
+type sinkDir struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (s *sink) receive(localPath string) error {
+	if err := s.ack(); err != nil {
+		return err
+	}
+
+	received := false
+	for {
+		code, err := s.reader.ReadByte()
+		if err == io.EOF && len(s.dirs) == 0 {
+			if received {
+				return nil
+			}
+			if s.warning != nil {
+				return &RemoteError{Message: s.warning.Message}
+			}
+			return errors.New("scp: no files received")
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch code {
+		case 1, 2:
+			remoteErr := &RemoteError{Message: line, Warning: code == 1}
+			if !remoteErr.Warning {
+				return remoteErr
+			}
+			if s.warning == nil {
+				s.warning = remoteErr
+			}
+		case 'T':
+			err = s.times(line)
+		case 'C':
+			err = s.file(line, s.target(localPath))
+			received = true
+		case 'D':
+			err = s.dir(line, s.target(localPath))
+			received = true
+		case 'E':
+			err = s.end()
+		default:
+			err = fmt.Errorf("unexpected scp record: %q", string(code)+line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// target returns the local path for a top-level record, which is localPath
+// itself unless it is an existing directory.
+func (s *sink) target(localPath string) func(name string) string {
+	return func(name string) string {
+		if len(s.dirs) > 0 {
+			return filepath.Join(s.dirs[len(s.dirs)-1].path, name)
+		}
+		if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+			return filepath.Join(localPath, name)
+		}
+		return localPath
+	}
+}
+
+func (s *sink) times(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) != 4 {
+		return fmt.Errorf("invalid scp times record: %q", "T"+line)
+	}
+	mtime, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid scp times record: %q", "T"+line)
+	}
+	s.modTime = time.Unix(mtime, 0)
+	return s.ack()
+}
+
+func (s *sink) file(line string, target func(name string) string) error {
+	mode, size, name, err := parseRecord("C", line)
+	if err != nil {
+		return err
+	}
+	localPath := target(name)
+	modTime := s.modTime
+	s.modTime = time.Time{}
+	if err := s.ack(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(file, s.reader, size)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	// A file that the source fails to read is followed by a warning instead
+	// of a zero byte. The partial copy is removed, and the rest is received.
+	code, err := s.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		message, _ := s.reader.ReadString('\n')
+		os.Remove(localPath)
+		remoteErr := &RemoteError{Message: strings.TrimSuffix(message, "\n"), Warning: code == 1}
+		if !remoteErr.Warning {
+			return remoteErr
+		}
+		if s.warning == nil {
+			s.warning = remoteErr
+		}
+		return s.ack()
+	}
+	if err := os.Chmod(localPath, mode); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return s.ack()
+}
+
+func (s *sink) dir(line string, target func(name string) string) error {
+	mode, _, name, err := parseRecord("D", line)
+	if err != nil {
+		return err
+	}
+	localPath := target(name)
+	if err := os.Mkdir(localPath, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if info, err := os.Stat(localPath); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", localPath)
+	}
+
+	s.dirs = append(s.dirs, sinkDir{path: localPath, mode: mode, modTime: s.modTime})
+	s.modTime = time.Time{}
+	return s.ack()
+}
+
+func (s *sink) end() error {
+	if len(s.dirs) == 0 {
+		return errors.New("unexpected scp end of directory")
+	}
+	dir := s.dirs[len(s.dirs)-1]
+	s.dirs = s.dirs[:len(s.dirs)-1]
+
+	if err := os.Chmod(dir.path, dir.mode); err != nil {
+		return err
+	}
+	if !dir.modTime.IsZero() {
+		if err := os.Chtimes(dir.path, dir.modTime, dir.modTime); err != nil {
+			return err
+		}
+	}
+	return s.ack()
+}
+
+func (s *sink) ack() error {
+	_, err := s.writer.Write([]byte{0})
+	return err
+}
+
+// parseRecord parses a file or directory record, rejecting names that would
+// place files outside of the directory being received.
+func parseRecord(kind, line string) (os.FileMode, int64, string, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", kind+line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", kind+line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", kind+line)
+	}
+	name := fields[2]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return 0, 0, "", fmt.Errorf("invalid name in scp record: %q", name)
+	}
+	return os.FileMode(mode) & os.ModePerm, size, name, nil
+}
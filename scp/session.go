@@ -1,36 +1,105 @@
 package scp
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
+
+	"github.com/pivotal-cf/cf-watch/remote"
 )
 
 type Session struct {
+	// PreserveTimes sends the local modification time of every file and
+	// directory ahead of it, and asks the remote scp to apply modes exactly
+	// as sent, like scp -p.
+	PreserveTimes bool
+
+	// DeltaMinSize enables SendDeltas for regular files of at least this
+	// many bytes. Zero disables it.
+	DeltaMinSize int64
+
+	// KeepaliveInterval enables a keepalive request every interval, and
+	// KeepaliveMaxMissed is the number of requests in a row that may go
+	// unanswered before the connection is considered dead and closed.
+	KeepaliveInterval  time.Duration
+	KeepaliveMaxMissed int
+
+	// lock guards client and lost, which Dial reads from other goroutines
+	// while the session may be closed.
+	lock   sync.Mutex
 	client *ssh.Client
+	lost   <-chan struct{}
+}
+
+// Connect dials the SSH endpoint and authenticates with the provided
+// credentials. If hostKeyFingerprint is empty, any host key is accepted.
+func (s *Session) Connect(endpoint, username, password, hostKeyFingerprint string) error {
+	if s.client != nil {
+		return errors.New("already connected")
+	}
+
+	client, err := Dial(endpoint, username, password, hostKeyFingerprint)
+	if err != nil {
+		return err
+	}
+	return s.Attach(client)
 }
 
-func (s *Session) Connect(endpoint, username, password string) error {
+// Attach uses an already established connection, which is closed along with
+// the session.
+func (s *Session) Attach(client *ssh.Client) error {
 	if s.client != nil {
 		return errors.New("already connected")
 	}
+	s.lock.Lock()
+	s.client = client
+	s.lost = Monitor(client)
+	s.lock.Unlock()
+	if s.KeepaliveInterval > 0 {
+		Keepalive(client, s.lost, s.KeepaliveInterval, s.KeepaliveMaxMissed)
+	}
+	return nil
+}
+
+// Lost returns a channel that is closed once the connection ends, including
+// when it is closed for missing keepalives, so that it can be replaced before
+// it is next used. It returns nil when the session is not connected.
+func (s *Session) Lost() <-chan struct{} {
+	return s.lost
+}
 
-	var err error
-	s.client, err = ssh.Dial("tcp", endpoint, &ssh.ClientConfig{
+// Probe checks that the container provides the scp command.
+func (s *Session) Probe() error {
+	return s.exec("test -x /usr/bin/scp", nil, nil)
+}
+
+// Dial connects to an SSH endpoint using password authentication, verifying
+// the host key against hostKeyFingerprint unless it is empty.
+func Dial(endpoint, username, password, hostKeyFingerprint string) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
 		User: username,
 		Auth: []ssh.AuthMethod{
 			ssh.Password(password),
 		},
-	})
-	if err != nil {
-		return err
+	}
+	if hostKeyFingerprint != "" {
+		var err error
+		config.HostKeyCallback, err = verifyHostKey(hostKeyFingerprint)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return ssh.Dial("tcp", endpoint, config)
 }
 
 func (s *Session) Close() error {
@@ -40,46 +109,125 @@ func (s *Session) Close() error {
 	if err := s.client.Close(); err != nil {
 		return err
 	}
+	s.lock.Lock()
 	s.client = nil
+	s.lost = nil
+	s.lock.Unlock()
 	return nil
 }
 
-func (s *Session) Send(path string, contents io.ReadCloser, mode os.FileMode, size int64) error {
+// SendDir copies the contents of localDir to remoteDir using a single scp
+// exec, creating remoteDir and any nested directories as needed.
+func (s *Session) SendDir(remoteDir, localDir string) error {
+	var paths []string
+	err := filepath.Walk(localDir, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if walkPath == localDir {
+			return nil
+		}
+		relPath, err := filepath.Rel(localDir, walkPath)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.SendFiles(remoteDir, localDir, paths)
+}
+
+// SendFiles copies the listed files and directories, given as slash-separated
+// paths relative to localDir, to the same paths below remoteDir using a single
+// scp exec. Parent directories are sent along with each path so that they are
+// created as needed, and the parents of remoteDir are created by the same exec
+// before the scp sink starts, since the sink only creates the last component
+// of its target. Large files are sent as deltas first if DeltaMinSize is set.
+// Listed directories are only created; SendDir sends a whole tree.
+func (s *Session) SendFiles(remoteDir, localDir string, paths []string) error {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	for _, relPath := range sorted {
+		if _, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(relPath))); err != nil {
+			return err
+		}
+	}
+	if s.DeltaMinSize > 0 {
+		if sorted = s.SendDeltas(remoteDir, localDir, sorted); len(sorted) == 0 {
+			return nil
+		}
+	}
+
+	remoteDir = path.Clean(remoteDir)
+	return s.scp(remoteDir, func(stream *stream) error {
+		tree := &treeWriter{stream: stream, localRoot: localDir}
+		if err := tree.dir(localDir, path.Base(remoteDir)); err != nil {
+			return err
+		}
+		for _, relPath := range sorted {
+			if err := tree.write(relPath); err != nil {
+				return err
+			}
+		}
+		return tree.close()
+	})
+}
+
+// scp creates remoteDir and runs the remote scp sink in its parent, then sends
+// records to it, starting with remoteDir itself. Errors caused by a lost
+// connection are returned as a *DisconnectedError.
+func (s *Session) scp(remoteDir string, send func(stream *stream) error) error {
 	if s.client == nil {
 		return errors.New("session closed")
 	}
+	return CheckConnection(s.lost, s.transfer(remoteDir, send))
+}
 
+func (s *Session) transfer(remoteDir string, send func(stream *stream) error) error {
 	session, err := s.client.NewSession()
 	if err != nil {
 		return err
 	}
 	defer session.Close()
 
-	errChan := make(chan error, 1)
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	sendErrChan := make(chan error, 1)
 	go func() {
-		stdin, err := session.StdinPipe()
-		if err != nil {
-			errChan <- err
-			return
-		}
 		defer stdin.Close()
 
-		fmt.Fprintf(stdin, "C%04o %d %s\n", mode, size, filepath.Base(path))
-
-		if _, err := io.Copy(stdin, contents); err != nil {
-			errChan <- err
-			return
+		stream := &stream{
+			writer:        stdin,
+			reader:        bufio.NewReader(stdout),
+			preserveTimes: s.PreserveTimes,
 		}
-		if _, err := stdin.Write([]byte{0}); err != nil {
-			errChan <- err
+		if err := stream.ack(); err != nil {
+			sendErrChan <- err
 			return
 		}
+		sendErrChan <- send(stream)
 	}()
-	go func() {
-		if err := session.Run(fmt.Sprintf("/usr/bin/scp -tr %s", filepath.Dir(path))); err != nil {
-			errChan <- err
-		}
-		close(errChan)
-	}()
-	return <-errChan
+
+	flags := "-tr"
+	if s.PreserveTimes {
+		flags = "-tpr"
+	}
+	runErr := session.Run(fmt.Sprintf("mkdir -p -- %s && /usr/bin/scp %s %s", remote.ShellQuote(remoteDir), flags, remote.ShellQuote(path.Dir(remoteDir))))
+	sendErr := <-sendErrChan
+	if runErr != nil && (sendErr == nil || sendErr == io.EOF) {
+		return runErr
+	}
+	return sendErr
 }
@@ -1,13 +1,26 @@
 package scp_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"strings"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/pivotal-cf/cf-watch/remote"
 	. "github.com/pivotal-cf/cf-watch/scp"
 	"github.com/pivotal-cf/cf-watch/scp/mocks"
 )
@@ -35,23 +48,62 @@ var _ = Describe("Session", func() {
 	Describe("#Connect", func() {
 		Context("with valid credentials", func() {
 			It("should successfully dial an SSH connection", func() {
-				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 				Expect(session.Close()).To(Succeed())
 			})
 		})
 
 		Context("with invalid credentials", func() {
 			It("should return an error", func() {
-				err := session.Connect(serverAddress, "some-invalid-user", "some-invalid-password")
+				err := session.Connect(serverAddress, "some-invalid-user", "some-invalid-password", "")
 				Expect(err).To(MatchError(ContainSubstring("ssh: unable to authenticate")))
 			})
 		})
 
+		Context("with a matching MD5 host key fingerprint", func() {
+			It("should successfully dial an SSH connection", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "c4:a8:a7:c2:07:bd:af:5a:d4:a0:b0:8a:cd:38:48:2a")).To(Succeed())
+				Expect(session.Close()).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "MD5:C4:A8:A7:C2:07:BD:AF:5A:D4:A0:B0:8A:CD:38:48:2A")).To(Succeed())
+				Expect(session.Close()).To(Succeed())
+			})
+		})
+
+		Context("with a matching SHA-256 host key fingerprint", func() {
+			It("should successfully dial an SSH connection", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "LVjPXcZPXnoTBxux1Bb0LGcw+VyM0YP79YX1bhvnDWU")).To(Succeed())
+				Expect(session.Close()).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "SHA256:LVjPXcZPXnoTBxux1Bb0LGcw+VyM0YP79YX1bhvnDWU")).To(Succeed())
+				Expect(session.Close()).To(Succeed())
+			})
+		})
+
+		Context("with a mismatched MD5 host key fingerprint", func() {
+			It("should return an error", func() {
+				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password", "00:a8:a7:c2:07:bd:af:5a:d4:a0:b0:8a:cd:38:48:2a")
+				Expect(err).To(MatchError(ContainSubstring("host key fingerprint mismatch: expected 00:a8:a7:c2:07:bd:af:5a:d4:a0:b0:8a:cd:38:48:2a, got c4:a8:a7:c2:07:bd:af:5a:d4:a0:b0:8a:cd:38:48:2a")))
+			})
+		})
+
+		Context("with a mismatched SHA-256 host key fingerprint", func() {
+			It("should return an error", func() {
+				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password", "SHA256:AAjPXcZPXnoTBxux1Bb0LGcw+VyM0YP79YX1bhvnDWU")
+				Expect(err).To(MatchError(ContainSubstring("host key fingerprint mismatch: expected SHA256:AAjPXcZPXnoTBxux1Bb0LGcw+VyM0YP79YX1bhvnDWU, got SHA256:LVjPXcZPXnoTBxux1Bb0LGcw+VyM0YP79YX1bhvnDWU")))
+			})
+		})
+
+		Context("with an unsupported host key fingerprint", func() {
+			It("should return an error", func() {
+				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password", "some-fingerprint")
+				Expect(err).To(MatchError("unsupported host key fingerprint: some-fingerprint"))
+			})
+		})
+
 		Context("when already connected", func() {
 			It("should return an error", func() {
-				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 				defer session.Close()
-				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password")
+				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")
 				Expect(err).To(MatchError("already connected"))
 			})
 		})
@@ -59,48 +111,370 @@ var _ = Describe("Session", func() {
 
 	Describe("#Close", func() {
 		It("should allow a session to be re-connected", func() {
-			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 			Expect(session.Close()).To(Succeed())
-			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 			Expect(session.Close()).To(Succeed())
 		})
 
 		Context("when called on a closed session", func() {
 			It("should succeed", func() {
-				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 				Expect(session.Close()).To(Succeed())
 				Expect(session.Close()).To(Succeed())
 			})
 		})
 	})
 
-	Describe("#Send", func() {
-		It("should send the provided contents and metadata", func(done Done) {
+	Describe("keepalives", func() {
+		BeforeEach(func() {
+			session.KeepaliveInterval = 10 * time.Millisecond
+			session.KeepaliveMaxMissed = 3
+		})
+
+		It("should send keepalives and stay connected while they are answered", func() {
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+			defer session.Close()
+
+			Eventually(mockSSHServer.Keepalives).Should(Receive())
+			Eventually(mockSSHServer.Keepalives).Should(Receive())
+			Consistently(session.Lost(), "100ms").ShouldNot(BeClosed())
+		})
+
+		Context("when too many keepalives in a row are unanswered", func() {
+			It("should close the connection and report it as lost", func() {
+				mockSSHServer.IgnoreKeepalives = true
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Eventually(session.Lost()).Should(BeClosed())
+				err := session.Remove("/home/vcap/app", []string{"some-file"})
+				Expect(err).To(BeAssignableToTypeOf(&DisconnectedError{}))
+				Expect(err.(*DisconnectedError).Disconnected()).To(BeTrue())
+			})
+		})
+
+		Context("when the interval is zero", func() {
+			It("should not send keepalives", func() {
+				session.KeepaliveInterval = 0
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Consistently(mockSSHServer.Keepalives, "50ms").ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("#SendDir", func() {
+		var localDir string
+
+		BeforeEach(func() {
+			var err error
+			localDir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chmod(localDir, 0750)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(localDir, "some-dir", "some-nested-dir"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some-dir", "some-nested-dir", "some-file"), []byte("some-contents"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some-file"), []byte(""), 0755)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+		})
+
+		It("should send every file and directory below the local directory", func(done Done) {
 			go func() {
 				defer GinkgoRecover()
 
-				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 				defer session.Close()
 
-				contents := ioutil.NopCloser(strings.NewReader("some-contents"))
-				Expect(session.Send("/tmp/watch", contents, 0644, 100)).To(Succeed())
+				Expect(session.SendDir("/home/vcap/app", localDir)).To(Succeed())
+
+				Expect(mockSSHServer.Received()).To(Equal([]mocks.SCPEntry{
+					{Path: "/home/vcap/app", Mode: 0750, Dir: true},
+					{Path: "/home/vcap/app/some-dir", Mode: 0700, Dir: true},
+					{Path: "/home/vcap/app/some-dir/some-nested-dir", Mode: 0700, Dir: true},
+					{Path: "/home/vcap/app/some-dir/some-nested-dir/some-file", Mode: 0600, Contents: "some-contents"},
+					{Path: "/home/vcap/app/some-file", Mode: 0755, Contents: ""},
+				}))
 
-				Expect(session.Close()).To(Succeed())
 				close(done)
 			}()
 
-			Eventually(mockSSHServer.Data).Should(gbytes.Say("C0644 100 watch\nsome-contents\x00"))
+			Eventually(mockSSHServer.CommandChan).Should(Receive())
+		})
+
+		Context("when the local directory does not exist", func() {
+			It("should return an error", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				err := session.SendDir("/home/vcap/app", filepath.Join(localDir, "some-missing-dir"))
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+		})
+	})
+
+	Describe("#SendFiles", func() {
+		var (
+			localDir string
+			tree     []string
+		)
+
+		BeforeEach(func() {
+			var err error
+			localDir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chmod(localDir, 0750)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(localDir, "some-dir", "some-nested-dir"), 0700)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(localDir, "some-empty-dir"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some-dir", "some-nested-dir", "some-file"), []byte("some-contents"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some-dir", "some-other-file"), []byte("some-other-contents"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some-file"), []byte(""), 0755)).To(Succeed())
+			tree = []string{"some-dir", "some-dir/some-nested-dir", "some-dir/some-nested-dir/some-file", "some-dir/some-other-file", "some-empty-dir", "some-file"}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+		})
+
+		It("should send the listed tree in a single scp stream", func(done Done) {
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.SendFiles("/home/vcap/app", localDir, tree)).To(Succeed())
+
+				Expect(mockSSHServer.Data.Contents()).To(Equal([]byte(
+					"D0750 0 app\n" +
+						"D0700 0 some-dir\n" +
+						"D0700 0 some-nested-dir\n" +
+						"C0600 13 some-file\nsome-contents\x00" +
+						"E\n" +
+						"C0644 19 some-other-file\nsome-other-contents\x00" +
+						"E\n" +
+						"D0755 0 some-empty-dir\n" +
+						"E\n" +
+						"C0755 0 some-file\n\x00" +
+						"E\n",
+				)))
+				Expect(mockSSHServer.Received()).To(Equal([]mocks.SCPEntry{
+					{Path: "/home/vcap/app", Mode: 0750, Dir: true},
+					{Path: "/home/vcap/app/some-dir", Mode: 0700, Dir: true},
+					{Path: "/home/vcap/app/some-dir/some-nested-dir", Mode: 0700, Dir: true},
+					{Path: "/home/vcap/app/some-dir/some-nested-dir/some-file", Mode: 0600, Contents: "some-contents"},
+					{Path: "/home/vcap/app/some-dir/some-other-file", Mode: 0644, Contents: "some-other-contents"},
+					{Path: "/home/vcap/app/some-empty-dir", Mode: 0755, Dir: true},
+					{Path: "/home/vcap/app/some-file", Mode: 0755, Contents: ""},
+				}))
+
+				close(done)
+			}()
 
 			var result string
 			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
-			Expect(result).To(Equal("/usr/bin/scp -tr /tmp"))
+			Expect(result).To(Equal("mkdir -p -- /home/vcap/app && /usr/bin/scp -tr /home/vcap"))
 		})
 
-		Context("when the session is not connected", func() {
-			It("should return an error", func() {
-				contents := ioutil.NopCloser(strings.NewReader(""))
-				err := session.Send("/tmp/watch", contents, 0644, 100)
-				Expect(err).To(MatchError("session closed"))
+		Context("when preserving times", func() {
+			It("should send a T record ahead of every file and directory", func(done Done) {
+				session.PreserveTimes = true
+
+				nestedDir := filepath.Join(localDir, "some-dir", "some-nested-dir")
+				Expect(os.RemoveAll(filepath.Join(localDir, "some-empty-dir"))).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(localDir, "some-dir", "some-other-file"))).To(Succeed())
+				Expect(os.RemoveAll(filepath.Join(localDir, "some-file"))).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(nestedDir, "some-file"), time.Unix(1400000000, 0), time.Unix(1400000003, 0))).To(Succeed())
+				Expect(os.Chtimes(nestedDir, time.Unix(1400000000, 0), time.Unix(1400000002, 0))).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(localDir, "some-dir"), time.Unix(1400000000, 0), time.Unix(1400000001, 0))).To(Succeed())
+				Expect(os.Chtimes(localDir, time.Unix(1400000000, 0), time.Unix(1400000000, 0))).To(Succeed())
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					Expect(session.SendFiles("/home/vcap/app", localDir, []string{"some-dir/some-nested-dir/some-file"})).To(Succeed())
+
+					Expect(mockSSHServer.Data.Contents()).To(Equal([]byte(
+						"T1400000000 0 1400000000 0\nD0750 0 app\n" +
+							"T1400000001 0 1400000001 0\nD0700 0 some-dir\n" +
+							"T1400000002 0 1400000002 0\nD0700 0 some-nested-dir\n" +
+							"T1400000003 0 1400000003 0\nC0600 13 some-file\nsome-contents\x00" +
+							"E\nE\nE\n",
+					)))
+					Expect(mockSSHServer.Received()).To(Equal([]mocks.SCPEntry{
+						{Path: "/home/vcap/app", Mode: 0750, Dir: true, ModTime: time.Unix(1400000000, 0)},
+						{Path: "/home/vcap/app/some-dir", Mode: 0700, Dir: true, ModTime: time.Unix(1400000001, 0)},
+						{Path: "/home/vcap/app/some-dir/some-nested-dir", Mode: 0700, Dir: true, ModTime: time.Unix(1400000002, 0)},
+						{Path: "/home/vcap/app/some-dir/some-nested-dir/some-file", Mode: 0600, Contents: "some-contents", ModTime: time.Unix(1400000003, 0)},
+					}))
+
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(Equal("mkdir -p -- /home/vcap/app && /usr/bin/scp -tpr /home/vcap"))
+			})
+		})
+
+		Context("when the remote scp command rejects some entries with warnings", func() {
+			It("should skip them, send the rest of the tree and return the first warning", func(done Done) {
+				mockSSHServer.SCPWarnings = map[string]string{
+					"/home/vcap/app/some-dir":       "scp: /home/vcap/app/some-dir: Permission denied",
+					"/home/vcap/app/some-empty-dir": "scp: /home/vcap/app/some-empty-dir: Permission denied",
+					"/home/vcap/app/some-file":      "scp: /home/vcap/app/some-file: Read-only file system",
+				}
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.SendFiles("/home/vcap/app", localDir, tree)
+					Expect(err).To(Equal(&RemoteError{Message: "scp: /home/vcap/app/some-dir: Permission denied", Warning: true}))
+
+					Expect(mockSSHServer.Data.Contents()).To(Equal([]byte(
+						"D0750 0 app\n" +
+							"D0700 0 some-dir\n" +
+							"D0755 0 some-empty-dir\n" +
+							"C0755 0 some-file\n" +
+							"E\n",
+					)))
+					Expect(mockSSHServer.Received()).To(Equal([]mocks.SCPEntry{
+						{Path: "/home/vcap/app", Mode: 0750, Dir: true},
+					}))
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the remote scp command reports an error", func() {
+			It("should stop sending and return a fatal remote error", func(done Done) {
+				mockSSHServer.SCPError = "scp: /home/vcap/app: No space left on device"
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.SendFiles("/home/vcap/app", localDir, tree)
+					Expect(err).To(Equal(&RemoteError{Message: "scp: /home/vcap/app: No space left on device"}))
+					Expect(mockSSHServer.Received()).To(BeEmpty())
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the remote directory needs quoting", func() {
+			It("should quote the scp target", func(done Done) {
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					Expect(session.SendFiles("/home/some user's/app", localDir, tree)).To(Succeed())
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(Equal(`mkdir -p -- '/home/some user'\''s/app' && /usr/bin/scp -tr '/home/some user'\''s'`))
+			})
+		})
+
+		Context("when the parents of the remote directory do not exist", func() {
+			It("should create them before the scp sink starts", func() {
+				remoteRoot, err := ioutil.TempDir("", "cf-watch-remote")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(remoteRoot)
+
+				mockSSHServer.Exec = func(command string, stdin io.Reader, stdout, stderr io.Writer) byte {
+					cmd := exec.Command("sh", "-c", command)
+					cmd.Stdin = stdin
+					cmd.Stdout = stdout
+					cmd.Stderr = stderr
+					if err := cmd.Run(); err != nil {
+						return 1
+					}
+					return 0
+				}
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				remoteDir := filepath.Join(remoteRoot, "some-missing-dir", "app")
+				Expect(session.SendFiles(remoteDir, localDir, []string{"some-dir/some-other-file"})).To(Succeed())
+
+				Expect(ioutil.ReadFile(filepath.Join(remoteDir, "some-dir", "some-other-file"))).To(Equal([]byte("some-other-contents")))
+			})
+		})
+
+		Context("when only some paths are listed", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(localDir, "src", "handlers"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "handlers", "user.go"), []byte("some-contents"), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "handlers", "admin.go"), []byte("some-other-contents"), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "main.go"), []byte("some-main-contents"), 0644)).To(Succeed())
+			})
+
+			It("should send only the listed paths along with their parent directories", func(done Done) {
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					Expect(session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go", "src/handlers/user.go"})).To(Succeed())
+
+					Expect(mockSSHServer.Data.Contents()).To(Equal([]byte(
+						"D0750 0 app\n" +
+							"D0700 0 src\n" +
+							"D0700 0 handlers\n" +
+							"C0600 13 user.go\nsome-contents\x00" +
+							"E\n" +
+							"C0644 18 main.go\nsome-main-contents\x00" +
+							"E\n" +
+							"E\n",
+					)))
+					Expect(mockSSHServer.Received()).To(Equal([]mocks.SCPEntry{
+						{Path: "/home/vcap/app", Mode: 0750, Dir: true},
+						{Path: "/home/vcap/app/src", Mode: 0700, Dir: true},
+						{Path: "/home/vcap/app/src/handlers", Mode: 0700, Dir: true},
+						{Path: "/home/vcap/app/src/handlers/user.go", Mode: 0600, Contents: "some-contents"},
+						{Path: "/home/vcap/app/src/main.go", Mode: 0644, Contents: "some-main-contents"},
+					}))
+
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(Equal("mkdir -p -- /home/vcap/app && /usr/bin/scp -tr /home/vcap"))
+			})
+
+			Context("when a listed path does not exist", func() {
+				It("should return an error without sending anything", func() {
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go", "src/missing.go"})
+					Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+					Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+				})
 			})
 		})
 
@@ -108,11 +482,10 @@ var _ = Describe("Session", func() {
 			It("should return an error", func() {
 				mockSSHServer.RejectSession = true
 
-				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 				defer session.Close()
 
-				contents := ioutil.NopCloser(strings.NewReader(""))
-				err := session.Send("/tmp/watch", contents, 0644, 100)
+				err := session.SendFiles("/home/vcap/app", localDir, tree)
 				Expect(err).To(MatchError("ssh: rejected: connect failed (session rejected)"))
 			})
 		})
@@ -124,11 +497,134 @@ var _ = Describe("Session", func() {
 				go func() {
 					defer GinkgoRecover()
 
-					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password")).To(Succeed())
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.SendFiles("/home/vcap/app", localDir, tree)
+					Expect(err).To(MatchError(ContainSubstring("Process exited with: 1")))
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the session is not connected", func() {
+			It("should return an error", func() {
+				err := session.SendFiles("/home/vcap/app", localDir, tree)
+				Expect(err).To(MatchError("session closed"))
+			})
+		})
+	})
+
+	Describe("#Remove", func() {
+		It("should remove the listed paths below the remote directory in one exec", func(done Done) {
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.Remove("/home/vcap/app", []string{"src/main.go", "some dir"})).To(Succeed())
+
+				close(done)
+			}()
+
+			var result string
+			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+			Expect(result).To(Equal("rm -rf -- /home/vcap/app/src/main.go '/home/vcap/app/some dir'"))
+		})
+
+		DescribeTable("should refuse paths outside of the remote directory",
+			func(remoteDir, relPath string) {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				err := session.Remove(remoteDir, []string{"src/main.go", relPath})
+				Expect(err).To(BeAssignableToTypeOf(&PathError{}))
+				Expect(err).To(MatchError(ContainSubstring("refusing to modify")))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			},
+			Entry("with a parent path", "/home/vcap/app", "../some-file"),
+			Entry("with a nested parent path", "/home/vcap/app", "src/../../some-file"),
+			Entry("with the remote directory itself", "/home/vcap/app", "."),
+			Entry("with an empty path", "/home/vcap/app", ""),
+			Entry("with an absolute path", "/home/vcap/app", "/etc/passwd"),
+			Entry("with a sibling directory prefix", "/home/vcap/app", "../app-other/some-file"),
+			Entry("with the root as the remote directory", "/", "some-file"),
+			Entry("with a relative remote directory", "app", "some-file"),
+		)
+
+		Context("when the remote command fails", func() {
+			It("should return its error output", func(done Done) {
+				mockSSHServer.CommandExitStatus = 1
+				mockSSHServer.CommandStderr = "rm: cannot remove '/home/vcap/app/src': Permission denied\n"
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.Remove("/home/vcap/app", []string{"src"})
+					Expect(err).To(MatchError("rm: cannot remove '/home/vcap/app/src': Permission denied"))
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the session is not connected", func() {
+			It("should return an error", func() {
+				err := session.Remove("/home/vcap/app", []string{"src"})
+				Expect(err).To(MatchError("session closed"))
+			})
+		})
+	})
+
+	Describe("#Rename", func() {
+		It("should move the old path to the new path, replacing it", func(done Done) {
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.Rename("/home/vcap/app", "src/handlers", "lib/some handlers")).To(Succeed())
+
+				close(done)
+			}()
+
+			var result string
+			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+			Expect(result).To(Equal("mkdir -p -- /home/vcap/app/lib && rm -rf -- '/home/vcap/app/lib/some handlers' && mv -f -- /home/vcap/app/src/handlers '/home/vcap/app/lib/some handlers'"))
+		})
+
+		Context("when either path is outside of the remote directory", func() {
+			It("should return an error without running anything", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.Rename("/home/vcap/app", "../some-file", "some-file")).To(BeAssignableToTypeOf(&PathError{}))
+				Expect(session.Rename("/home/vcap/app", "some-file", "../some-file")).To(BeAssignableToTypeOf(&PathError{}))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			})
+		})
+
+		Context("when the remote command fails", func() {
+			It("should return an error", func(done Done) {
+				mockSSHServer.CommandExitStatus = 1
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
 					defer session.Close()
 
-					contents := ioutil.NopCloser(strings.NewReader(""))
-					err := session.Send("/tmp/watch", contents, 0644, 100)
+					err := session.Rename("/home/vcap/app", "some-file", "some-other-file")
 					Expect(err).To(MatchError(ContainSubstring("Process exited with: 1")))
 
 					close(done)
@@ -138,4 +634,615 @@ var _ = Describe("Session", func() {
 			})
 		})
 	})
+
+	Describe("#Run", func() {
+		var command string
+
+		BeforeEach(func() {
+			mockSSHServer.Exec = func(cmd string, _ io.Reader, stdout, stderr io.Writer) byte {
+				command = cmd
+				fmt.Fprint(stdout, "some-output")
+				fmt.Fprint(stderr, "some-error-output")
+				return mockSSHServer.CommandExitStatus
+			}
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should run the command in the remote directory and stream its output", func() {
+			stdout, stderr := gbytes.NewBuffer(), gbytes.NewBuffer()
+			Expect(session.Run("/home/vcap/some app/", "kill -HUP 1", stdout, stderr)).To(Succeed())
+
+			Expect(command).To(Equal("cd -- '/home/vcap/some app' || exit; kill -HUP 1"))
+			Expect(stdout).To(gbytes.Say("some-output"))
+			Expect(stderr).To(gbytes.Say("some-error-output"))
+		})
+
+		Context("when the command exits with a non-zero status", func() {
+			It("should return its exit status", func() {
+				mockSSHServer.CommandExitStatus = 2
+
+				err := session.Run("/home/vcap/app", "go build", ioutil.Discard, ioutil.Discard)
+				Expect(err).To(BeAssignableToTypeOf(&ssh.ExitError{}))
+				Expect(err.(*ssh.ExitError).ExitStatus()).To(Equal(2))
+			})
+		})
+	})
+
+	Describe("#Dial", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				request, err := ioutil.ReadAll(conn)
+				Expect(err).NotTo(HaveOccurred())
+				fmt.Fprintf(conn, "echo: %s", request)
+			}()
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+			listener.Close()
+		})
+
+		It("should open a connection to the address from the container", func() {
+			conn, err := session.Dial(listener.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			fmt.Fprint(conn, "some-request")
+			Expect(conn.(interface {
+				CloseWrite() error
+			}).CloseWrite()).To(Succeed())
+			Expect(ioutil.ReadAll(conn)).To(Equal([]byte("echo: some-request")))
+		})
+
+		Context("when the address cannot be reached", func() {
+			It("should return an error", func() {
+				address := listener.Addr().String()
+				listener.Close()
+
+				_, err := session.Dial(address)
+				Expect(err).To(MatchError(ContainSubstring("ssh: rejected: connect failed")))
+			})
+		})
+
+		Context("when the session is closed while dialing", func() {
+			It("should return a connection or an error", func() {
+				dialed := make(chan error, 1)
+				go func() {
+					conn, err := session.Dial(listener.Addr().String())
+					if err == nil {
+						conn.Close()
+					}
+					dialed <- err
+				}()
+
+				Expect(session.Close()).To(Succeed())
+				Eventually(dialed).Should(Receive())
+			})
+		})
+	})
+
+	Describe("#Receive", func() {
+		var remoteDir, localDir string
+
+		BeforeEach(func() {
+			var err error
+			remoteDir, err = ioutil.TempDir("", "cf-watch-remote")
+			Expect(err).NotTo(HaveOccurred())
+			localDir, err = ioutil.TempDir("", "cf-watch-local")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(remoteDir, "some-dir", "some-nested-dir"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(remoteDir, "some-dir", "some-file"), []byte("some-contents"), 0640)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(remoteDir, "some-dir", "some-nested-dir", "some-script"), []byte("some-script-contents"), 0755)).To(Succeed())
+			modTime := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+			Expect(os.Chtimes(filepath.Join(remoteDir, "some-dir", "some-file"), modTime, modTime)).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(remoteDir, "some-dir", "some-nested-dir"), modTime, modTime)).To(Succeed())
+
+			mockSSHServer.Exec = func(command string, stdin io.Reader, stdout, stderr io.Writer) byte {
+				Expect(command).To(HavePrefix("/usr/bin/scp -rpf "))
+				cmd := exec.Command("sh", "-c", command)
+				cmd.Stdout = stdout
+				cmd.Stderr = stderr
+				acks, err := cmd.StdinPipe()
+				Expect(err).NotTo(HaveOccurred())
+				go io.Copy(acks, stdin)
+				if err := cmd.Run(); err != nil {
+					return 1
+				}
+				return 0
+			}
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+			Expect(os.RemoveAll(remoteDir)).To(Succeed())
+		})
+
+		It("should copy a directory recursively, preserving modes and modification times", func() {
+			target := filepath.Join(localDir, "some-target")
+			Expect(session.Receive(filepath.Join(remoteDir, "some-dir"), target)).To(Succeed())
+
+			Expect(ioutil.ReadFile(filepath.Join(target, "some-file"))).To(Equal([]byte("some-contents")))
+			Expect(ioutil.ReadFile(filepath.Join(target, "some-nested-dir", "some-script"))).To(Equal([]byte("some-script-contents")))
+
+			info, err := os.Stat(filepath.Join(target, "some-file"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0640)))
+			Expect(info.ModTime()).To(BeTemporally("==", time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)))
+			info, err = os.Stat(filepath.Join(target, "some-nested-dir", "some-script"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0755)))
+			info, err = os.Stat(filepath.Join(target, "some-nested-dir"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("==", time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)))
+		})
+
+		It("should copy into an existing directory", func() {
+			Expect(session.Receive(filepath.Join(remoteDir, "some-dir", "some-file"), localDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(localDir, "some-file"))).To(Equal([]byte("some-contents")))
+
+			Expect(session.Receive(filepath.Join(remoteDir, "some-dir"), localDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(localDir, "some-dir", "some-nested-dir", "some-script"))).To(Equal([]byte("some-script-contents")))
+		})
+
+		It("should copy a file to a new path", func() {
+			target := filepath.Join(localDir, "some-copy")
+			Expect(session.Receive(filepath.Join(remoteDir, "some-dir", "some-file"), target)).To(Succeed())
+			Expect(ioutil.ReadFile(target)).To(Equal([]byte("some-contents")))
+		})
+
+		Context("when the remote path does not exist", func() {
+			It("should return a fatal remote error", func() {
+				err := session.Receive(filepath.Join(remoteDir, "some-missing-file"), localDir)
+				Expect(err).To(BeAssignableToTypeOf(&RemoteError{}))
+				Expect(err.(*RemoteError).Fatal()).To(BeTrue())
+				Expect(err).To(MatchError(ContainSubstring("No such file or directory")))
+			})
+		})
+
+		Context("when a file cannot be read completely", func() {
+			It("should remove the partial copy, receive the rest and return a warning", func() {
+				mockSSHServer.Exec = func(_ string, stdin io.Reader, stdout, _ io.Writer) byte {
+					acks := make([]byte, 1)
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "D0755 0 some-dir\n")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "C0644 4 some-broken-file\n")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "some\x01scp: some-broken-file: Input/output error\n")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "C0644 4 some-file\n")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "some\x00")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "E\n")
+					io.ReadFull(stdin, acks)
+					return 1
+				}
+
+				target := filepath.Join(localDir, "some-target")
+				err := session.Receive("/home/vcap/app/some-dir", target)
+				Expect(err).To(BeAssignableToTypeOf(&RemoteError{}))
+				Expect(err.(*RemoteError).Fatal()).To(BeFalse())
+				Expect(err).To(MatchError("scp: some-broken-file: Input/output error"))
+				_, err = os.Stat(filepath.Join(target, "some-broken-file"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+				Expect(ioutil.ReadFile(filepath.Join(target, "some-file"))).To(Equal([]byte("some")))
+			})
+		})
+
+		Context("when the container sends a name outside of the target", func() {
+			It("should return an error without writing the file", func() {
+				mockSSHServer.Exec = func(_ string, stdin io.Reader, stdout, _ io.Writer) byte {
+					acks := make([]byte, 1)
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "D0755 0 some-dir\n")
+					io.ReadFull(stdin, acks)
+					fmt.Fprint(stdout, "C0644 4 ../some-escape\nevil\x00")
+					ioutil.ReadAll(stdin)
+					return 1
+				}
+
+				err := session.Receive("/home/vcap/app/some-dir", filepath.Join(localDir, "some-target"))
+				Expect(err).To(MatchError(`invalid name in scp record: "../some-escape"`))
+				_, err = os.Stat(filepath.Join(localDir, "some-escape"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("#SendArchive", func() {
+		var localDir string
+
+		BeforeEach(func() {
+			var err error
+			localDir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(localDir, "src", "handlers"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "handlers", "user.go"), []byte("some-contents"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "main.go"), []byte("some-main-contents"), 0644)).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(localDir, "src", "main.go"), time.Unix(1400000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+		})
+
+		It("should stream the listed paths and their parent directories as a compressed tar archive", func(done Done) {
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.SendArchive("/home/vcap/some app", localDir, []string{"src/main.go", "src/handlers/user.go"})).To(Succeed())
+
+				compressed, err := gzip.NewReader(bytes.NewReader(mockSSHServer.Data.Contents()))
+				Expect(err).NotTo(HaveOccurred())
+				archive := tar.NewReader(compressed)
+
+				type entry struct {
+					Name     string
+					Mode     int64
+					Contents string
+				}
+				var entries []entry
+				for {
+					header, err := archive.Next()
+					if err == io.EOF {
+						break
+					}
+					Expect(err).NotTo(HaveOccurred())
+					contents, err := ioutil.ReadAll(archive)
+					Expect(err).NotTo(HaveOccurred())
+					entries = append(entries, entry{Name: header.Name, Mode: header.Mode, Contents: string(contents)})
+					if header.Name == "src/main.go" {
+						Expect(header.ModTime).To(Equal(time.Unix(1500000000, 0)))
+					}
+				}
+				Expect(entries).To(Equal([]entry{
+					{Name: "src/", Mode: 0700},
+					{Name: "src/handlers/", Mode: 0700},
+					{Name: "src/handlers/user.go", Mode: 0600, Contents: "some-contents"},
+					{Name: "src/main.go", Mode: 0644, Contents: "some-main-contents"},
+				}))
+
+				close(done)
+			}()
+
+			var result string
+			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+			Expect(result).To(Equal("mkdir -p -- '/home/vcap/some app' && tar -xzf - -m -C '/home/vcap/some app'"))
+		})
+
+		Context("when preserving times", func() {
+			It("should let tar apply the archived modification times", func(done Done) {
+				session.PreserveTimes = true
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					Expect(session.SendArchive("/home/vcap/app", localDir, []string{"src/main.go"})).To(Succeed())
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(Equal("mkdir -p -- /home/vcap/app && tar -xzf - -C /home/vcap/app"))
+			})
+		})
+
+		Context("when the remote command fails", func() {
+			It("should return its error output", func(done Done) {
+				mockSSHServer.CommandExitStatus = 2
+				mockSSHServer.CommandStderr = "tar: src/main.go: Cannot open: Permission denied\n"
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					err := session.SendArchive("/home/vcap/app", localDir, []string{"src/main.go"})
+					Expect(err).To(MatchError("tar: src/main.go: Cannot open: Permission denied"))
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when a listed path does not exist", func() {
+			It("should return an error without running anything", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				err := session.SendArchive("/home/vcap/app", localDir, []string{"src/main.go", "src/missing.go"})
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			})
+		})
+
+		Context("when a listed path is outside of the remote directory", func() {
+			It("should return an error without running anything", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				err := session.SendArchive("/home/vcap/app", localDir, []string{"src/.."})
+				Expect(err).To(BeAssignableToTypeOf(&PathError{}))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("#RemoveList", func() {
+		It("should pass the paths to rm on stdin in one exec", func(done Done) {
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				Expect(session.RemoveList("/home/vcap/app", []string{"src/main.go", "some dir"})).To(Succeed())
+				Expect(mockSSHServer.Data.Contents()).To(Equal([]byte("/home/vcap/app/src/main.go\x00/home/vcap/app/some dir\x00")))
+
+				close(done)
+			}()
+
+			var result string
+			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+			Expect(result).To(Equal("xargs -0 -r rm -rf --"))
+		})
+
+		Context("when a path is outside of the remote directory", func() {
+			It("should return an error without running anything", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				err := session.RemoveList("/home/vcap/app", []string{"src/main.go", "../some-file"})
+				Expect(err).To(BeAssignableToTypeOf(&PathError{}))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			})
+		})
+	})
+
+	Describe("#SendDeltas", func() {
+		var (
+			localDir, remoteDir string
+			old                 []byte
+			commands            []string
+			received            int
+		)
+
+		BeforeEach(func() {
+			var err error
+			localDir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			remoteDir, err = ioutil.TempDir("", "cf-watch-remote")
+			Expect(err).NotTo(HaveOccurred())
+
+			old = make([]byte, 300*1024)
+			rand.New(rand.NewSource(1)).Read(old)
+			Expect(ioutil.WriteFile(filepath.Join(remoteDir, "some.bin"), old, 0644)).To(Succeed())
+
+			commands = nil
+			received = 0
+			mockSSHServer.Exec = func(command string, stdin io.Reader, stdout, stderr io.Writer) byte {
+				commands = append(commands, command)
+				input, err := ioutil.ReadAll(stdin)
+				Expect(err).NotTo(HaveOccurred())
+				received += len(input)
+
+				cmd := exec.Command("sh", "-c", command)
+				cmd.Stdin = bytes.NewReader(input)
+				cmd.Stdout = stdout
+				cmd.Stderr = stderr
+				if err := cmd.Run(); err != nil {
+					return 1
+				}
+				return 0
+			}
+
+			session.DeltaMinSize = 1
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+			Expect(os.RemoveAll(remoteDir)).To(Succeed())
+		})
+
+		It("should send only the bytes that differ from the remote copy", func() {
+			session.PreserveTimes = true
+
+			changed := append(append(append([]byte(nil), old[:100000]...), []byte("some-inserted-bytes")...), old[100000:]...)
+			copy(changed[250000:], "some-overwritten-bytes")
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), changed, 0600)).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(localDir, "some.bin"), time.Unix(1500000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+
+			Expect(session.SendDeltas(remoteDir, localDir, []string{"some.bin"})).To(BeEmpty())
+
+			Expect(ioutil.ReadFile(filepath.Join(remoteDir, "some.bin"))).To(Equal(changed))
+			info, err := os.Stat(filepath.Join(remoteDir, "some.bin"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0600)))
+			Expect(info.ModTime()).To(Equal(time.Unix(1500000000, 0)))
+
+			Expect(commands).To(HaveLen(2))
+			Expect(received).To(BeNumerically("<", 3*4096))
+			Expect(filepath.Glob(filepath.Join(remoteDir, ".cf-watch-*"))).To(BeEmpty())
+		})
+
+		It("should be used by SendFiles for large files", func() {
+			changed := append([]byte(nil), old...)
+			copy(changed[1000:], "some-overwritten-bytes")
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), changed, 0644)).To(Succeed())
+
+			Expect(session.SendFiles(remoteDir, localDir, []string{"some.bin"})).To(Succeed())
+
+			Expect(ioutil.ReadFile(filepath.Join(remoteDir, "some.bin"))).To(Equal(changed))
+			Expect(commands).To(HaveLen(2))
+		})
+
+		DescribeTable("should leave files that are cheaper to send in full",
+			func(setup func()) {
+				setup()
+
+				Expect(session.SendDeltas(remoteDir, localDir, []string{"some.bin"})).To(Equal([]string{"some.bin"}))
+			},
+			Entry("when the remote copy does not exist", func() {
+				Expect(os.Remove(filepath.Join(remoteDir, "some.bin"))).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), old, 0644)).To(Succeed())
+			}),
+			Entry("when the file is smaller than the minimum size", func() {
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), old[:1000], 0644)).To(Succeed())
+				session.DeltaMinSize = 2000
+			}),
+			Entry("when the file differs everywhere", func() {
+				changed := make([]byte, len(old))
+				rand.New(rand.NewSource(2)).Read(changed)
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), changed, 0644)).To(Succeed())
+			}),
+			Entry("when the checksums cannot be computed", func() {
+				changed := append([]byte(nil), old...)
+				copy(changed[1000:], "some-overwritten-bytes")
+				Expect(ioutil.WriteFile(filepath.Join(localDir, "some.bin"), changed, 0644)).To(Succeed())
+				mockSSHServer.Exec = func(string, io.Reader, io.Writer, io.Writer) byte {
+					return 127
+				}
+			}),
+		)
+	})
+
+	Describe("#List", func() {
+		It("should list the regular files below the remote directory in one exec", func(done Done) {
+			mockSSHServer.CommandStdout = "13 1500000000.1234567890 src/main.go\x00" +
+				"0 1500000001.0000000000 some dir/some file\x00"
+
+			go func() {
+				defer GinkgoRecover()
+
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				files, err := session.List("/home/vcap/app", false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(Equal(map[string]remote.File{
+					"src/main.go":        {Size: 13, ModTime: time.Unix(1500000000, 0)},
+					"some dir/some file": {Size: 0, ModTime: time.Unix(1500000001, 0)},
+				}))
+
+				close(done)
+			}()
+
+			var result string
+			Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+			Expect(result).To(Equal(`if [ -d /home/vcap/app ]; then cd /home/vcap/app && find . -type f -printf '%s %T@ %P\0'; fi`))
+		})
+
+		Context("when checksums are requested", func() {
+			It("should include the SHA-1 of every file", func(done Done) {
+				mockSSHServer.CommandStdout = "13 1500000000.1234567890 src/main.go\x00" +
+					"0 1500000001.0000000000 some dir/some file\x00" +
+					"0 1500000002.0000000000 some\\odd\nfile\x00" +
+					"\x00" +
+					"2142a57cb8587400fa7f4ee492f25cf07567f4a5  ./src/main.go\n" +
+					"da39a3ee5e6b4b0d3255bfef95601890afd80709  ./some dir/some file\n" +
+					"\\8b5e6b2b7ad3a3ad7e9f5a2da4e6c4c0e8f1b1b2  ./some\\\\odd\\nfile\n"
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					files, err := session.List("/home/vcap/app", true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(files).To(Equal(map[string]remote.File{
+						"src/main.go":        {Size: 13, ModTime: time.Unix(1500000000, 0), Hash: "2142a57cb8587400fa7f4ee492f25cf07567f4a5"},
+						"some dir/some file": {Size: 0, ModTime: time.Unix(1500000001, 0), Hash: "da39a3ee5e6b4b0d3255bfef95601890afd80709"},
+						"some\\odd\nfile":    {Size: 0, ModTime: time.Unix(1500000002, 0), Hash: "8b5e6b2b7ad3a3ad7e9f5a2da4e6c4c0e8f1b1b2"},
+					}))
+
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(HaveSuffix(`-printf '%s %T@ %P\0' && printf '\0' && find . -type f -exec sha1sum -- {} +; fi`))
+			})
+		})
+
+		Context("when the remote directory is empty or missing", func() {
+			It("should return no files", func(done Done) {
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					files, err := session.List("/home/vcap/app", true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(files).To(BeEmpty())
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the listing cannot be parsed", func() {
+			It("should return an error", func(done Done) {
+				mockSSHServer.CommandStdout = "some-garbage\x00"
+
+				go func() {
+					defer GinkgoRecover()
+
+					Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer session.Close()
+
+					_, err := session.List("/home/vcap/app", false)
+					Expect(err).To(MatchError(`invalid file listing: "some-garbage"`))
+
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the remote directory is relative", func() {
+			It("should return an error without running anything", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+
+				_, err := session.List("app", false)
+				Expect(err).To(MatchError("remote directory must be absolute: app"))
+				Consistently(mockSSHServer.CommandChan).ShouldNot(Receive())
+			})
+		})
+	})
 })
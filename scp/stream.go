@@ -0,0 +1,93 @@
+package scp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// RemoteError is a message reported by the remote scp process in place of an
+// acknowledgement. Warnings only affect the record they answer, while any
+// other error aborts the transfer.
+type RemoteError struct {
+	Message string
+	Warning bool
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+func (e *RemoteError) Fatal() bool {
+	return !e.Warning
+}
+
+// stream speaks the source side of the scp protocol, waiting for the remote
+// sink to acknowledge every record before moving on.
+type stream struct {
+	writer        io.Writer
+	reader        *bufio.Reader
+	preserveTimes bool
+}
+
+func (s *stream) record(format string, args ...interface{}) error {
+	if _, err := fmt.Fprintf(s.writer, format+"\n", args...); err != nil {
+		return err
+	}
+	return s.ack()
+}
+
+func (s *stream) ack() error {
+	code, err := s.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		return nil
+	}
+
+	message, err := s.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return &RemoteError{
+		Message: strings.TrimSuffix(message, "\n"),
+		Warning: code == 1,
+	}
+}
+
+func (s *stream) times(modTime time.Time) error {
+	if !s.preserveTimes || modTime.IsZero() {
+		return nil
+	}
+	return s.record("T%d 0 %d 0", modTime.Unix(), modTime.Unix())
+}
+
+func (s *stream) dir(name string, mode os.FileMode, modTime time.Time) error {
+	if err := s.times(modTime); err != nil {
+		return err
+	}
+	return s.record("D%04o 0 %s", mode, name)
+}
+
+func (s *stream) file(name string, mode os.FileMode, size int64, modTime time.Time, contents io.Reader) error {
+	if err := s.times(modTime); err != nil {
+		return err
+	}
+	if err := s.record("C%04o %d %s", mode, size, name); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(s.writer, contents, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if _, err := s.writer.Write([]byte{0}); err != nil {
+		return err
+	}
+	return s.ack()
+}
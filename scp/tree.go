@@ -0,0 +1,119 @@
+package scp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// treeWriter emits scp records for a sorted list of slash-separated paths
+// relative to localRoot, opening and closing directories with D and E records
+// as the paths move through the tree. The first entry of stack is the
+// directory that localRoot is sent as.
+//
+// Warnings from the sink do not abort the transfer: a rejected file is
+// skipped, a rejected directory is skipped along with its contents, and the
+// first warning is kept so that it can be reported once the tree is sent.
+type treeWriter struct {
+	*stream
+	localRoot string
+	stack     []string
+	skipped   string
+	warning   error
+}
+
+func (t *treeWriter) write(relPath string) error {
+	if t.skipped != "" && strings.HasPrefix(relPath, t.skipped) {
+		return nil
+	}
+
+	localPath := filepath.Join(t.localRoot, filepath.FromSlash(relPath))
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(relPath, "/")
+	if info.IsDir() {
+		return t.warn(t.enter(parts))
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if err := t.enter(parts[:len(parts)-1]); err != nil {
+		return t.warn(err)
+	}
+	return t.warn(t.file(localPath, info))
+}
+
+func (t *treeWriter) enter(parts []string) error {
+	depth := 1
+	for depth < len(t.stack) && depth-1 < len(parts) && t.stack[depth] == parts[depth-1] {
+		depth++
+	}
+	for len(t.stack) > depth {
+		if err := t.leave(); err != nil {
+			return err
+		}
+	}
+	for i := len(t.stack) - 1; i < len(parts); i++ {
+		localPath := filepath.Join(t.localRoot, filepath.Join(parts[:i+1]...))
+		if err := t.dir(localPath, parts[i]); err != nil {
+			t.skipped = strings.Join(parts[:i+1], "/") + "/"
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *treeWriter) leave() error {
+	if err := t.record("E"); err != nil {
+		return err
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+	return nil
+}
+
+func (t *treeWriter) close() error {
+	for len(t.stack) > 0 {
+		if err := t.leave(); err != nil {
+			return err
+		}
+	}
+	return t.warning
+}
+
+func (t *treeWriter) dir(localPath, name string) error {
+	mode := os.FileMode(0755)
+	var modTime time.Time
+	if info, err := os.Stat(localPath); err == nil {
+		mode = info.Mode().Perm()
+		modTime = info.ModTime()
+	}
+	if err := t.stream.dir(name, mode, modTime); err != nil {
+		return err
+	}
+	t.stack = append(t.stack, name)
+	return nil
+}
+
+func (t *treeWriter) file(localPath string, info os.FileInfo) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return t.stream.file(info.Name(), info.Mode().Perm(), info.Size(), info.ModTime(), file)
+}
+
+func (t *treeWriter) warn(err error) error {
+	if remoteErr, ok := err.(*RemoteError); ok && remoteErr.Warning {
+		if t.warning == nil {
+			t.warning = remoteErr
+		}
+		return nil
+	}
+	return err
+}
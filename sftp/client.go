@@ -0,0 +1,580 @@
+package sftp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Packet types from version 3 of the SSH File Transfer Protocol, which is the
+// version served by OpenSSH and Diego's SSH daemon.
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpOpen    = 3
+	fxpClose   = 4
+	fxpRead    = 5
+	fxpWrite   = 6
+	fxpLstat   = 7
+	fxpSetstat = 9
+	fxpOpendir = 11
+	fxpReaddir = 12
+	fxpRemove  = 13
+	fxpMkdir   = 14
+	fxpRmdir   = 15
+	fxpStat    = 17
+	fxpRename  = 18
+	fxpStatus  = 101
+	fxpHandle  = 102
+	fxpData    = 103
+	fxpName    = 104
+	fxpAttrs   = 105
+)
+
+const (
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+)
+
+const (
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+)
+
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+)
+
+const (
+	protocolVersion = 3
+	maxPacket       = 256 * 1024
+	chunkSize       = 32 * 1024
+)
+
+// StatusError is a failure reported by the SFTP server for a request.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return "sftp: " + e.Message
+	}
+	return fmt.Sprintf("sftp: request failed with status %d", e.Code)
+}
+
+// Fatal reports whether the error prevents further requests from succeeding.
+// Missing files and denied permissions only affect the path concerned.
+func (e *StatusError) Fatal() bool {
+	return e.Code != fxNoSuchFile && e.Code != fxPermissionDenied
+}
+
+// Client speaks the SFTP protocol over a pair of streams, usually the stdin
+// and stdout of an SSH channel running the sftp subsystem. Requests are sent
+// one at a time.
+type Client struct {
+	lock   sync.Mutex
+	writer io.WriteCloser
+	reader *bufio.Reader
+	nextID uint32
+}
+
+// NewClient negotiates the protocol version with the server.
+func NewClient(reader io.Reader, writer io.WriteCloser) (*Client, error) {
+	c := &Client{writer: writer, reader: bufio.NewReader(reader)}
+
+	init := &packet{}
+	init.byte(fxpInit)
+	init.uint32(protocolVersion)
+	if err := c.send(init); err != nil {
+		return nil, err
+	}
+	typ, response, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if typ != fxpVersion {
+		return nil, fmt.Errorf("sftp: unexpected packet type %d during init", typ)
+	}
+	version, err := response.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if version < protocolVersion {
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", version)
+	}
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.writer.Close()
+}
+
+// Stat returns information about a path, following symbolic links.
+func (c *Client) Stat(name string) (os.FileInfo, error) {
+	return c.stat(fxpStat, name)
+}
+
+// Lstat returns information about a path without following symbolic links.
+func (c *Client) Lstat(name string) (os.FileInfo, error) {
+	return c.stat(fxpLstat, name)
+}
+
+func (c *Client) stat(typ byte, name string) (os.FileInfo, error) {
+	response, err := c.request(typ, fxpAttrs, func(p *packet) {
+		p.string(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := response.attrs()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), attrs: attrs}, nil
+}
+
+func (c *Client) Mkdir(name string, mode os.FileMode) error {
+	return c.status(fxpMkdir, func(p *packet) {
+		p.string(name)
+		p.attrs(&attrs{flags: attrPermissions, permissions: uint32(mode.Perm())})
+	})
+}
+
+func (c *Client) Remove(name string) error {
+	return c.status(fxpRemove, func(p *packet) {
+		p.string(name)
+	})
+}
+
+func (c *Client) Rmdir(name string) error {
+	return c.status(fxpRmdir, func(p *packet) {
+		p.string(name)
+	})
+}
+
+// Rename moves oldPath to newPath. Servers using version 3 of the protocol
+// refuse to replace an existing newPath.
+func (c *Client) Rename(oldPath, newPath string) error {
+	return c.status(fxpRename, func(p *packet) {
+		p.string(oldPath)
+		p.string(newPath)
+	})
+}
+
+func (c *Client) Chmod(name string, mode os.FileMode) error {
+	return c.status(fxpSetstat, func(p *packet) {
+		p.string(name)
+		p.attrs(&attrs{flags: attrPermissions, permissions: uint32(mode.Perm())})
+	})
+}
+
+func (c *Client) Chtimes(name string, atime, mtime time.Time) error {
+	return c.status(fxpSetstat, func(p *packet) {
+		p.string(name)
+		p.attrs(&attrs{flags: attrACModTime, atime: uint32(atime.Unix()), mtime: uint32(mtime.Unix())})
+	})
+}
+
+// WriteFile creates or truncates name and copies contents into it. The mode
+// only applies to newly created files.
+func (c *Client) WriteFile(name string, contents io.Reader, mode os.FileMode) error {
+	handle, err := c.open(name, fxfWrite|fxfCreat|fxfTrunc, &attrs{flags: attrPermissions, permissions: uint32(mode.Perm())})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	var offset uint64
+	for {
+		n, readErr := contents.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+			if err := c.status(fxpWrite, func(p *packet) {
+				p.string(handle)
+				p.uint64(offset)
+				p.bytes(data)
+			}); err != nil {
+				c.close(handle)
+				return err
+			}
+			offset += uint64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			c.close(handle)
+			return readErr
+		}
+	}
+	return c.close(handle)
+}
+
+// ReadFile copies the contents of name to w.
+func (c *Client) ReadFile(name string, w io.Writer) error {
+	handle, err := c.open(name, fxfRead, &attrs{})
+	if err != nil {
+		return err
+	}
+
+	var offset uint64
+	for {
+		response, err := c.request(fxpRead, fxpData, func(p *packet) {
+			p.string(handle)
+			p.uint64(offset)
+			p.uint32(chunkSize)
+		})
+		if statusErr, ok := err.(*StatusError); ok && statusErr.Code == fxEOF {
+			break
+		}
+		if err != nil {
+			c.close(handle)
+			return err
+		}
+		data, err := response.stringBytes()
+		if err != nil {
+			c.close(handle)
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			c.close(handle)
+			return err
+		}
+		offset += uint64(len(data))
+	}
+	return c.close(handle)
+}
+
+// ReadDir lists the entries of a directory, excluding . and ...
+func (c *Client) ReadDir(name string) ([]os.FileInfo, error) {
+	response, err := c.request(fxpOpendir, fxpHandle, func(p *packet) {
+		p.string(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	handle, err := response.string()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []os.FileInfo
+	for {
+		response, err := c.request(fxpReaddir, fxpName, func(p *packet) {
+			p.string(handle)
+		})
+		if statusErr, ok := err.(*StatusError); ok && statusErr.Code == fxEOF {
+			break
+		}
+		if err != nil {
+			c.close(handle)
+			return nil, err
+		}
+		count, err := response.uint32()
+		if err != nil {
+			c.close(handle)
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			name, err := response.string()
+			if err != nil {
+				c.close(handle)
+				return nil, err
+			}
+			if _, err := response.string(); err != nil {
+				c.close(handle)
+				return nil, err
+			}
+			attrs, err := response.attrs()
+			if err != nil {
+				c.close(handle)
+				return nil, err
+			}
+			if name != "." && name != ".." {
+				entries = append(entries, &fileInfo{name: name, attrs: attrs})
+			}
+		}
+	}
+	return entries, c.close(handle)
+}
+
+func (c *Client) open(name string, flags uint32, a *attrs) (string, error) {
+	response, err := c.request(fxpOpen, fxpHandle, func(p *packet) {
+		p.string(name)
+		p.uint32(flags)
+		p.attrs(a)
+	})
+	if err != nil {
+		return "", err
+	}
+	return response.string()
+}
+
+func (c *Client) close(handle string) error {
+	return c.status(fxpClose, func(p *packet) {
+		p.string(handle)
+	})
+}
+
+// status sends a request that is answered with a status packet only.
+func (c *Client) status(typ byte, build func(p *packet)) error {
+	_, err := c.request(typ, fxpStatus, build)
+	return err
+}
+
+// request sends a packet and reads the response, which must either have the
+// expected type or be a status packet. Status packets other than OK are
+// returned as a *StatusError.
+func (c *Client) request(typ, expected byte, build func(p *packet)) (*reader, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nextID++
+	id := c.nextID
+
+	request := &packet{}
+	request.byte(typ)
+	request.uint32(id)
+	build(request)
+	if err := c.send(request); err != nil {
+		return nil, err
+	}
+
+	responseType, response, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	responseID, err := response.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if responseID != id {
+		return nil, fmt.Errorf("sftp: response id %d does not match request id %d", responseID, id)
+	}
+
+	if responseType == fxpStatus {
+		code, err := response.uint32()
+		if err != nil {
+			return nil, err
+		}
+		message, _ := response.string()
+		if code != fxOK || expected != fxpStatus {
+			return nil, &StatusError{Code: code, Message: message}
+		}
+		return response, nil
+	}
+	if responseType != expected {
+		return nil, fmt.Errorf("sftp: unexpected packet type %d", responseType)
+	}
+	return response, nil
+}
+
+func (c *Client) send(p *packet) error {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(p.buf)))
+	if _, err := c.writer.Write(append(length, p.buf...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) receive() (byte, *reader, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 || length > maxPacket {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return body[0], &reader{buf: body[1:]}, nil
+}
+
+// attrs holds the file attributes that are sent and received with requests.
+type attrs struct {
+	flags       uint32
+	size        uint64
+	permissions uint32
+	atime       uint32
+	mtime       uint32
+}
+
+// packet builds the payload of an outgoing packet.
+type packet struct {
+	buf []byte
+}
+
+func (p *packet) byte(b byte) {
+	p.buf = append(p.buf, b)
+}
+
+func (p *packet) uint32(v uint32) {
+	p.buf = append(p.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (p *packet) uint64(v uint64) {
+	p.uint32(uint32(v >> 32))
+	p.uint32(uint32(v))
+}
+
+func (p *packet) string(s string) {
+	p.uint32(uint32(len(s)))
+	p.buf = append(p.buf, s...)
+}
+
+func (p *packet) bytes(b []byte) {
+	p.uint32(uint32(len(b)))
+	p.buf = append(p.buf, b...)
+}
+
+func (p *packet) attrs(a *attrs) {
+	p.uint32(a.flags)
+	if a.flags&attrSize != 0 {
+		p.uint64(a.size)
+	}
+	if a.flags&attrPermissions != 0 {
+		p.uint32(a.permissions)
+	}
+	if a.flags&attrACModTime != 0 {
+		p.uint32(a.atime)
+		p.uint32(a.mtime)
+	}
+}
+
+var errShortPacket = errors.New("sftp: packet too short")
+
+// reader parses the payload of an incoming packet.
+type reader struct {
+	buf []byte
+}
+
+func (r *reader) uint32() (uint32, error) {
+	if len(r.buf) < 4 {
+		return 0, errShortPacket
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v, nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	high, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	low, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(high)<<32 | uint64(low), nil
+}
+
+func (r *reader) stringBytes() ([]byte, error) {
+	length, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(r.buf)) < length {
+		return nil, errShortPacket
+	}
+	s := r.buf[:length]
+	r.buf = r.buf[length:]
+	return s, nil
+}
+
+func (r *reader) string() (string, error) {
+	s, err := r.stringBytes()
+	return string(s), err
+}
+
+func (r *reader) attrs() (*attrs, error) {
+	a := &attrs{}
+	var err error
+	if a.flags, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if a.flags&attrSize != 0 {
+		if a.size, err = r.uint64(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrUIDGID != 0 {
+		if _, err = r.uint64(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if a.permissions, err = r.uint32(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if a.atime, err = r.uint32(); err != nil {
+			return nil, err
+		}
+		if a.mtime, err = r.uint32(); err != nil {
+			return nil, err
+		}
+	}
+	if a.flags&attrExtended != 0 {
+		count, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < 2*count; i++ {
+			if _, err := r.stringBytes(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+// fileInfo implements os.FileInfo for attributes sent by the server.
+type fileInfo struct {
+	name  string
+	attrs *attrs
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return int64(f.attrs.size) }
+func (f *fileInfo) ModTime() time.Time { return time.Unix(int64(f.attrs.mtime), 0) }
+func (f *fileInfo) IsDir() bool        { return f.Mode().IsDir() }
+func (f *fileInfo) Sys() interface{}   { return nil }
+
+func (f *fileInfo) Mode() os.FileMode {
+	mode := os.FileMode(f.attrs.permissions & 0777)
+	switch f.attrs.permissions & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0100000:
+	default:
+		mode |= os.ModeIrregular
+	}
+	return mode
+}
@@ -0,0 +1,500 @@
+package sftp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+	"github.com/pivotal-cf/cf-watch/scp"
+)
+
+// Session implements watch.Session over the sftp subsystem, for containers
+// that do not provide an scp command.
+type Session struct {
+	// PreserveTimes applies the local modification time to every file that
+	// is sent, like scp -p.
+	PreserveTimes bool
+
+	// KeepaliveInterval and KeepaliveMaxMissed enable keepalive requests,
+	// as for scp.Session.
+	KeepaliveInterval  time.Duration
+	KeepaliveMaxMissed int
+
+	// lock guards client and lost, which Dial reads from other goroutines
+	// while the session may be closed.
+	lock    sync.Mutex
+	client  *ssh.Client
+	lost    <-chan struct{}
+	channel *ssh.Session
+	sftp    *Client
+}
+
+// Connect dials the SSH endpoint and starts the sftp subsystem. If
+// hostKeyFingerprint is empty, any host key is accepted.
+func (s *Session) Connect(endpoint, username, password, hostKeyFingerprint string) error {
+	if s.client != nil {
+		return errors.New("already connected")
+	}
+
+	client, err := scp.Dial(endpoint, username, password, hostKeyFingerprint)
+	if err != nil {
+		return err
+	}
+	if err := s.Attach(client); err != nil {
+		client.Close()
+		return err
+	}
+	return nil
+}
+
+// Attach starts the sftp subsystem on an already established connection,
+// which is closed along with the session.
+func (s *Session) Attach(client *ssh.Client) error {
+	if s.client != nil {
+		return errors.New("already connected")
+	}
+
+	channel, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	stdin, err := channel.StdinPipe()
+	if err != nil {
+		channel.Close()
+		return err
+	}
+	stdout, err := channel.StdoutPipe()
+	if err != nil {
+		channel.Close()
+		return err
+	}
+	if err := channel.RequestSubsystem("sftp"); err != nil {
+		channel.Close()
+		return err
+	}
+	sftpClient, err := NewClient(stdout, stdin)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	s.lock.Lock()
+	s.client = client
+	s.lost = scp.Monitor(client)
+	s.lock.Unlock()
+	s.channel = channel
+	s.sftp = sftpClient
+	if s.KeepaliveInterval > 0 {
+		scp.Keepalive(client, s.lost, s.KeepaliveInterval, s.KeepaliveMaxMissed)
+	}
+	return nil
+}
+
+// Lost returns a channel that is closed once the connection ends, or nil when
+// the session is not connected.
+func (s *Session) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// Run runs a shell command in remoteDir using a new exec on the session's
+// connection, streaming its output to stdout and stderr.
+func (s *Session) Run(remoteDir, command string, stdout, stderr io.Writer) error {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	return scp.CheckConnection(s.lost, scp.RunCommand(s.client, remoteDir, command, stdout, stderr))
+}
+
+// Dial opens a TCP connection from the container to address, over a
+// direct-tcpip channel on the session's connection. Unlike other methods, it
+// may be called while the session is being closed.
+func (s *Session) Dial(address string) (net.Conn, error) {
+	s.lock.Lock()
+	client, lost := s.client, s.lost
+	s.lock.Unlock()
+	if client == nil {
+		return nil, errors.New("session closed")
+	}
+	conn, err := client.Dial("tcp", address)
+	if err != nil {
+		return nil, scp.CheckConnection(lost, err)
+	}
+	return conn, nil
+}
+
+func (s *Session) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	s.sftp.Close()
+	s.channel.Close()
+	if err := s.client.Close(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.client = nil
+	s.lost = nil
+	s.lock.Unlock()
+	return nil
+}
+
+// SendFiles copies the listed files and directories, given as slash-separated
+// paths relative to localDir, to the same paths below remoteDir, creating
+// parent directories as needed. Files that the server rejects are skipped,
+// and the first rejection is returned once everything else is sent.
+func (s *Session) SendFiles(remoteDir, localDir string, paths []string) (err error) {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	defer func() { err = scp.CheckConnection(s.lost, err) }()
+
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	remotePaths := map[string]string{}
+	for _, relPath := range sorted {
+		if _, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(relPath))); err != nil {
+			return err
+		}
+		remotePath, err := scp.RemotePath(remoteDir, relPath)
+		if err != nil {
+			return err
+		}
+		remotePaths[relPath] = remotePath
+	}
+
+	dirs := &dirMaker{client: s.sftp, localDir: localDir, remoteDir: path.Clean(remoteDir), known: map[string]bool{}}
+	var warning error
+	for _, relPath := range sorted {
+		err := s.send(dirs, localDir, relPath, remotePaths[relPath])
+		if statusErr, ok := err.(*StatusError); ok && !statusErr.Fatal() {
+			if warning == nil {
+				warning = err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return warning
+}
+
+func (s *Session) send(dirs *dirMaker, localDir, relPath, remotePath string) error {
+	localPath := filepath.Join(localDir, filepath.FromSlash(relPath))
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return dirs.make(remotePath)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if err := dirs.make(path.Dir(remotePath)); err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := s.sftp.WriteFile(remotePath, file, info.Mode()); err != nil {
+		return err
+	}
+	if err := s.sftp.Chmod(remotePath, info.Mode()); err != nil {
+		return err
+	}
+	if s.PreserveTimes {
+		return s.sftp.Chtimes(remotePath, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// Remove deletes the listed files and directories, given as slash-separated
+// paths relative to remoteDir. Directories are removed along with their
+// contents, and paths that do not exist are ignored.
+func (s *Session) Remove(remoteDir string, paths []string) (err error) {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	defer func() { err = scp.CheckConnection(s.lost, err) }()
+
+	var remotePaths []string
+	for _, relPath := range paths {
+		remotePath, err := scp.RemotePath(remoteDir, relPath)
+		if err != nil {
+			return err
+		}
+		remotePaths = append(remotePaths, remotePath)
+	}
+	for _, remotePath := range remotePaths {
+		if err := s.removeAll(remotePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename moves a file or directory below remoteDir, replacing anything that
+// already exists at the new path and creating its parent directories.
+func (s *Session) Rename(remoteDir, oldPath, newPath string) (err error) {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	defer func() { err = scp.CheckConnection(s.lost, err) }()
+
+	oldRemotePath, err := scp.RemotePath(remoteDir, oldPath)
+	if err != nil {
+		return err
+	}
+	newRemotePath, err := scp.RemotePath(remoteDir, newPath)
+	if err != nil {
+		return err
+	}
+
+	dirs := &dirMaker{client: s.sftp, remoteDir: path.Clean(remoteDir), known: map[string]bool{}}
+	if err := dirs.make(path.Dir(newRemotePath)); err != nil {
+		return err
+	}
+	if err := s.removeAll(newRemotePath); err != nil {
+		return err
+	}
+	return s.sftp.Rename(oldRemotePath, newRemotePath)
+}
+
+// List returns the regular files below remoteDir, keyed by slash-separated
+// paths relative to remoteDir. Checksums are computed by reading every file,
+// since the protocol has no way to hash files remotely.
+func (s *Session) List(remoteDir string, checksum bool) (_ map[string]remote.File, err error) {
+	if s.client == nil {
+		return nil, errors.New("session closed")
+	}
+	defer func() { err = scp.CheckConnection(s.lost, err) }()
+	if !path.IsAbs(remoteDir) {
+		return nil, fmt.Errorf("remote directory must be absolute: %s", remoteDir)
+	}
+
+	files := map[string]remote.File{}
+	if _, err := s.sftp.Stat(remoteDir); isNotExist(err) {
+		return files, nil
+	}
+	if err := s.list(remoteDir, "", checksum, files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (s *Session) list(remoteDir, relDir string, checksum bool, files map[string]remote.File) error {
+	entries, err := s.sftp.ReadDir(path.Join(remoteDir, relDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := checkName(path.Join(remoteDir, relDir), entry.Name()); err != nil {
+			return err
+		}
+		relPath := path.Join(relDir, entry.Name())
+		if entry.IsDir() {
+			if err := s.list(remoteDir, relPath, checksum, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		file := remote.File{Size: entry.Size(), ModTime: entry.ModTime()}
+		if checksum {
+			hash := sha1.New()
+			if err := s.sftp.ReadFile(path.Join(remoteDir, relPath), hash); err != nil {
+				return err
+			}
+			file.Hash = hex.EncodeToString(hash.Sum(nil))
+		}
+		files[relPath] = file
+	}
+	return nil
+}
+
+// Receive copies remotePath, a file or a directory, from the container to
+// localPath, preserving modes and modification times. If localPath is an
+// existing directory, remotePath is copied into it, as with scp.Session.
+// Files that the server refuses to read are skipped, and the first refusal
+// is returned once everything else is copied.
+func (s *Session) Receive(remotePath, localPath string) (err error) {
+	if s.client == nil {
+		return errors.New("session closed")
+	}
+	defer func() { err = scp.CheckConnection(s.lost, err) }()
+
+	info, err := s.sftp.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+	if local, err := os.Stat(localPath); err == nil && local.IsDir() {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+
+	var warning error
+	if err := s.receive(remotePath, localPath, info, &warning); err != nil {
+		return err
+	}
+	return warning
+}
+
+func (s *Session) receive(remotePath, localPath string, info os.FileInfo, warning *error) error {
+	if info.IsDir() {
+		if err := os.Mkdir(localPath, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		entries, err := s.sftp.ReadDir(remotePath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := checkName(remotePath, entry.Name()); err != nil {
+				return err
+			}
+			err := s.receive(path.Join(remotePath, entry.Name()), filepath.Join(localPath, entry.Name()), entry, warning)
+			if statusErr, ok := err.(*StatusError); ok && !statusErr.Fatal() {
+				if *warning == nil {
+					*warning = err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	} else if info.Mode().IsRegular() {
+		file, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		err = s.sftp.ReadFile(remotePath, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(localPath)
+			return err
+		}
+	} else {
+		return nil
+	}
+
+	if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(localPath, info.ModTime(), info.ModTime())
+}
+
+// checkName rejects directory entries whose names would lead outside of
+// remoteDir, or outside of the local directory they are copied to, since the
+// names are chosen by the server.
+func checkName(remoteDir, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("sftp: invalid file name %q in %s", name, remoteDir)
+	}
+	return nil
+}
+
+func (s *Session) removeAll(remotePath string) error {
+	info, err := s.sftp.Lstat(remotePath)
+	if isNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s.sftp.Remove(remotePath)
+	}
+
+	entries, err := s.sftp.ReadDir(remotePath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.removeAll(path.Join(remotePath, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return s.sftp.Rmdir(remotePath)
+}
+
+// dirMaker creates remote directories and their parents, using the mode of
+// the matching local directory when there is one.
+type dirMaker struct {
+	client    *Client
+	localDir  string
+	remoteDir string
+	known     map[string]bool
+}
+
+func (d *dirMaker) make(remotePath string) error {
+	if d.known[remotePath] || remotePath == "/" {
+		return nil
+	}
+
+	info, err := d.client.Stat(remotePath)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", remotePath)
+		}
+		d.known[remotePath] = true
+		return nil
+	}
+	if !isNotExist(err) {
+		return err
+	}
+
+	if err := d.make(path.Dir(remotePath)); err != nil {
+		return err
+	}
+	if err := d.client.Mkdir(remotePath, d.mode(remotePath)); err != nil {
+		return err
+	}
+	d.known[remotePath] = true
+	return nil
+}
+
+func (d *dirMaker) mode(remotePath string) os.FileMode {
+	if d.localDir == "" {
+		return 0755
+	}
+
+	localPath := d.localDir
+	if remotePath != d.remoteDir {
+		if !strings.HasPrefix(remotePath, d.remoteDir+"/") {
+			return 0755
+		}
+		localPath = filepath.Join(d.localDir, filepath.FromSlash(strings.TrimPrefix(remotePath, d.remoteDir+"/")))
+	}
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		return info.Mode().Perm()
+	}
+	return 0755
+}
+
+func isNotExist(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Code == fxNoSuchFile
+}
@@ -0,0 +1,357 @@
+package sftp_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+	"github.com/pivotal-cf/cf-watch/scp"
+	"github.com/pivotal-cf/cf-watch/scp/mocks"
+	. "github.com/pivotal-cf/cf-watch/sftp"
+)
+
+var _ = Describe("Session", func() {
+	var (
+		session       *Session
+		mockSSHServer *mocks.SSHServer
+		serverAddress string
+		remoteRoot    string
+		localDir      string
+	)
+
+	remotePath := func(relPath string) string {
+		return filepath.Join(remoteRoot, "home", "vcap", "app", filepath.FromSlash(relPath))
+	}
+
+	BeforeEach(func() {
+		var err error
+		remoteRoot, err = ioutil.TempDir("", "cf-watch-remote")
+		Expect(err).NotTo(HaveOccurred())
+		localDir, err = ioutil.TempDir("", "cf-watch")
+		Expect(err).NotTo(HaveOccurred())
+
+		session = &Session{}
+		mockSSHServer = &mocks.SSHServer{
+			User:     "some-valid-user",
+			Password: "some-valid-password",
+			SFTPRoot: remoteRoot,
+		}
+		serverAddress = mockSSHServer.Start()
+	})
+
+	AfterEach(func() {
+		mockSSHServer.Stop()
+		Expect(os.RemoveAll(remoteRoot)).To(Succeed())
+		Expect(os.RemoveAll(localDir)).To(Succeed())
+	})
+
+	Describe("#Connect", func() {
+		It("should start the sftp subsystem", func() {
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+			Expect(session.Close()).To(Succeed())
+		})
+
+		Context("with invalid credentials", func() {
+			It("should return an error", func() {
+				err := session.Connect(serverAddress, "some-invalid-user", "some-invalid-password", "")
+				Expect(err).To(MatchError(ContainSubstring("ssh: unable to authenticate")))
+			})
+		})
+
+		Context("when the server does not provide the sftp subsystem", func() {
+			It("should return an error", func() {
+				mockSSHServer.SFTPRoot = ""
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).NotTo(Succeed())
+			})
+		})
+
+		Context("when already connected", func() {
+			It("should return an error", func() {
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+				defer session.Close()
+				err := session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")
+				Expect(err).To(MatchError("already connected"))
+			})
+		})
+	})
+
+	Describe("#SendFiles", func() {
+		BeforeEach(func() {
+			Expect(os.Chmod(localDir, 0750)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(localDir, "src", "handlers"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "handlers", "user.go"), []byte("some-contents"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "src", "main.go"), []byte("some-main-contents"), 0644)).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(localDir, "src", "main.go"), time.Unix(1400000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should send the listed paths and create their parent directories", func() {
+			Expect(session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go", "src/handlers/user.go"})).To(Succeed())
+
+			Expect(ioutil.ReadFile(remotePath("src/main.go"))).To(Equal([]byte("some-main-contents")))
+			Expect(ioutil.ReadFile(remotePath("src/handlers/user.go"))).To(Equal([]byte("some-contents")))
+
+			info, err := os.Stat(remotePath("src/handlers/user.go"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0600)))
+			info, err = os.Stat(remotePath("src/handlers"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.ModeDir | 0700))
+			info, err = os.Stat(remotePath(""))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.ModeDir | 0750))
+		})
+
+		It("should replace existing files", func() {
+			Expect(os.MkdirAll(remotePath("src"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/main.go"), []byte("some-much-longer-old-contents"), 0644)).To(Succeed())
+
+			Expect(session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go"})).To(Succeed())
+
+			Expect(ioutil.ReadFile(remotePath("src/main.go"))).To(Equal([]byte("some-main-contents")))
+		})
+
+		Context("when preserving times", func() {
+			It("should apply the local modification time", func() {
+				session.PreserveTimes = true
+
+				Expect(session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go"})).To(Succeed())
+
+				info, err := os.Stat(remotePath("src/main.go"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ModTime()).To(Equal(time.Unix(1500000000, 0)))
+			})
+		})
+
+		Context("when the server rejects a path", func() {
+			It("should send the rest and return a non-fatal error", func() {
+				Expect(session.Close()).To(Succeed())
+				mockSSHServer.SFTPDenied = map[string]bool{"/home/vcap/app/src/handlers/user.go": true}
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+
+				err := session.SendFiles("/home/vcap/app", localDir, []string{"src/handlers/user.go", "src/main.go"})
+				Expect(err).To(MatchError("sftp: permission denied"))
+				Expect(err.(*StatusError).Fatal()).To(BeFalse())
+
+				Expect(ioutil.ReadFile(remotePath("src/main.go"))).To(Equal([]byte("some-main-contents")))
+				Expect(remotePath("src/handlers/user.go")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when a listed path does not exist", func() {
+			It("should return an error without sending anything", func() {
+				err := session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go", "src/missing.go"})
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+				Expect(remotePath("src/main.go")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when a listed path is outside of the remote directory", func() {
+			It("should return an error without sending anything", func() {
+				err := session.SendFiles("/home/vcap/app", localDir, []string{"src/main.go", "src/../.."})
+				Expect(err).To(MatchError(&scp.PathError{RemoteDir: "/home/vcap/app", Path: "src/../.."}))
+				Expect(remotePath("src/main.go")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("#Remove", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(remotePath("src/handlers"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/handlers/user.go"), []byte("some-contents"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/main.go"), []byte("some-contents"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("Procfile"), []byte("some-contents"), 0644)).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should remove files and directories along with their contents", func() {
+			Expect(session.Remove("/home/vcap/app", []string{"src/handlers", "Procfile", "some-missing-file"})).To(Succeed())
+
+			Expect(remotePath("src/handlers")).NotTo(BeAnExistingFile())
+			Expect(remotePath("Procfile")).NotTo(BeAnExistingFile())
+			Expect(remotePath("src/main.go")).To(BeAnExistingFile())
+		})
+
+		Context("when a path is outside of the remote directory", func() {
+			It("should return an error without removing anything", func() {
+				err := session.Remove("/home/vcap/app", []string{"Procfile", ""})
+				Expect(err).To(MatchError(&scp.PathError{RemoteDir: "/home/vcap/app", Path: ""}))
+				Expect(remotePath("Procfile")).To(BeAnExistingFile())
+			})
+		})
+	})
+
+	Describe("#Rename", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(remotePath("src"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/main.go"), []byte("some-contents"), 0644)).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should move the old path to the new path and create its parents", func() {
+			Expect(session.Rename("/home/vcap/app", "src", "lib/src")).To(Succeed())
+
+			Expect(ioutil.ReadFile(remotePath("lib/src/main.go"))).To(Equal([]byte("some-contents")))
+			Expect(remotePath("src")).NotTo(BeAnExistingFile())
+		})
+
+		It("should replace an existing new path", func() {
+			Expect(ioutil.WriteFile(remotePath("main.go"), []byte("some-other-contents"), 0644)).To(Succeed())
+
+			Expect(session.Rename("/home/vcap/app", "src/main.go", "main.go")).To(Succeed())
+
+			Expect(ioutil.ReadFile(remotePath("main.go"))).To(Equal([]byte("some-contents")))
+		})
+	})
+
+	Describe("#List", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(remotePath("src/empty"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/main.go"), []byte("some-text"), 0644)).To(Succeed())
+			Expect(os.Chtimes(remotePath("src/main.go"), time.Unix(1500000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+			Expect(os.Symlink("src/main.go", remotePath("some-link"))).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should list the regular files below the remote directory", func() {
+			Expect(session.List("/home/vcap/app", false)).To(Equal(map[string]remote.File{
+				"src/main.go": {Size: 9, ModTime: time.Unix(1500000000, 0)},
+			}))
+		})
+
+		Context("when checksums are requested", func() {
+			It("should include the SHA-1 of every file", func() {
+				Expect(session.List("/home/vcap/app", true)).To(Equal(map[string]remote.File{
+					"src/main.go": {Size: 9, ModTime: time.Unix(1500000000, 0), Hash: "2142a57cb8587400fa7f4ee492f25cf07567f4a5"},
+				}))
+			})
+		})
+
+		Context("when the remote directory is missing", func() {
+			It("should return no files", func() {
+				Expect(session.List("/home/vcap/missing", false)).To(BeEmpty())
+			})
+		})
+
+		Context("when the remote directory is relative", func() {
+			It("should return an error", func() {
+				_, err := session.List("app", false)
+				Expect(err).To(MatchError("remote directory must be absolute: app"))
+			})
+		})
+
+		Context("when the server lists an entry with a path separator", func() {
+			It("should return an error", func() {
+				Expect(session.Close()).To(Succeed())
+				mockSSHServer.SFTPEntries = map[string][]string{"/home/vcap/app/src": {`..\escaped`}}
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+
+				_, err := session.List("/home/vcap/app", false)
+				Expect(err).To(MatchError(`sftp: invalid file name "..\\escaped" in /home/vcap/app/src`))
+			})
+		})
+	})
+
+	Describe("#Receive", func() {
+		BeforeEach(func() {
+			Expect(os.MkdirAll(remotePath("src/handlers"), 0750)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/handlers/user.go"), []byte("some-contents"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(remotePath("src/main.go"), []byte("some-main-contents"), 0755)).To(Succeed())
+			Expect(os.Chtimes(remotePath("src/main.go"), time.Unix(1500000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+			Expect(os.Chtimes(remotePath("src/handlers"), time.Unix(1400000000, 0), time.Unix(1400000000, 0))).To(Succeed())
+			Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(session.Close()).To(Succeed())
+		})
+
+		It("should copy a directory recursively, preserving modes and modification times", func() {
+			target := filepath.Join(localDir, "some-target")
+			Expect(session.Receive("/home/vcap/app/src", target)).To(Succeed())
+
+			Expect(ioutil.ReadFile(filepath.Join(target, "main.go"))).To(Equal([]byte("some-main-contents")))
+			Expect(ioutil.ReadFile(filepath.Join(target, "handlers", "user.go"))).To(Equal([]byte("some-contents")))
+
+			info, err := os.Stat(filepath.Join(target, "main.go"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode()).To(Equal(os.FileMode(0755)))
+			Expect(info.ModTime()).To(Equal(time.Unix(1500000000, 0)))
+			info, err = os.Stat(filepath.Join(target, "handlers"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+			Expect(info.ModTime()).To(Equal(time.Unix(1400000000, 0)))
+		})
+
+		It("should copy into an existing directory", func() {
+			Expect(session.Receive("/home/vcap/app/src/main.go", localDir)).To(Succeed())
+			Expect(ioutil.ReadFile(filepath.Join(localDir, "main.go"))).To(Equal([]byte("some-main-contents")))
+		})
+
+		Context("when the server rejects a path", func() {
+			It("should copy the rest and return a non-fatal error", func() {
+				Expect(session.Close()).To(Succeed())
+				mockSSHServer.SFTPDenied = map[string]bool{"/home/vcap/app/src/handlers/user.go": true}
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+
+				err := session.Receive("/home/vcap/app/src", localDir)
+				Expect(err).To(MatchError("sftp: permission denied"))
+				Expect(err.(*StatusError).Fatal()).To(BeFalse())
+
+				Expect(ioutil.ReadFile(filepath.Join(localDir, "src", "main.go"))).To(Equal([]byte("some-main-contents")))
+				Expect(filepath.Join(localDir, "src", "handlers", "user.go")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when the remote path does not exist", func() {
+			It("should return an error", func() {
+				Expect(session.Receive("/home/vcap/app/missing", localDir)).To(MatchError(ContainSubstring("no such file")))
+			})
+		})
+
+		Context("when the server lists an entry that leads outside of the directory", func() {
+			It("should return an error without writing outside of the local path", func() {
+				Expect(ioutil.WriteFile(remotePath("escaped"), []byte("some-contents"), 0644)).To(Succeed())
+				Expect(session.Close()).To(Succeed())
+				mockSSHServer.SFTPEntries = map[string][]string{"/home/vcap/app/src": {"../escaped"}}
+				Expect(session.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+
+				target := filepath.Join(localDir, "some-target")
+				Expect(session.Receive("/home/vcap/app/src", target)).To(MatchError(`sftp: invalid file name "../escaped" in /home/vcap/app/src`))
+				Expect(filepath.Join(localDir, "escaped")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Context("when the session is not connected", func() {
+		It("should return an error from every operation", func() {
+			Expect(session.SendFiles("/home/vcap/app", localDir, []string{})).To(MatchError("session closed"))
+			Expect(session.Remove("/home/vcap/app", []string{"some-file"})).To(MatchError("session closed"))
+			Expect(session.Rename("/home/vcap/app", "some-file", "some-other-file")).To(MatchError("session closed"))
+			_, err := session.List("/home/vcap/app", false)
+			Expect(err).To(MatchError("session closed"))
+			Expect(session.Receive("/home/vcap/app", localDir)).To(MatchError("session closed"))
+		})
+	})
+})
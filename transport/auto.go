@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/cf-watch/scp"
+	"github.com/pivotal-cf/cf-watch/sftp"
+	"github.com/pivotal-cf/cf-watch/watch"
+)
+
+// Thresholds above which Auto sends a batch as a tar stream, and the size
+// from which files are sent as deltas when enabled.
+const (
+	archiveFiles = 100
+	archiveBytes = 1 << 20
+	deltaMinSize = 1 << 20
+)
+
+// Auto is a watch.Session that picks a transport once it is connected. It
+// uses scp when the container provides /usr/bin/scp, and falls back to the
+// sftp subsystem otherwise. Both are tried over the same connection, since
+// the one-time SSH code cannot be used twice.
+//
+// When scp is used, batches of more than ArchiveFiles paths or ArchiveBytes
+// bytes are sent as a tar stream instead, and removes of more than
+// ArchiveFiles paths are sent as an rm list. A zero threshold is never
+// reached. Files of at least DeltaMinSize bytes are sent as deltas over scp
+// when it is set, and not at all if sftp is used, which SendsDeltas reports.
+// Keepalives are sent over the connection as configured by
+// KeepaliveInterval and KeepaliveMaxMissed, whichever transport is used.
+type Auto struct {
+	PreserveTimes      bool
+	ArchiveFiles       int
+	ArchiveBytes       int64
+	DeltaMinSize       int64
+	KeepaliveInterval  time.Duration
+	KeepaliveMaxMissed int
+
+	// lock guards Session, which Dial reads from other goroutines while
+	// the session may be closed.
+	lock sync.Mutex
+	watch.Session
+	archive *Tar
+}
+
+func (a *Auto) Connect(endpoint, username, password, hostKeyFingerprint string) error {
+	if a.Session != nil {
+		return errors.New("already connected")
+	}
+
+	client, err := scp.Dial(endpoint, username, password, hostKeyFingerprint)
+	if err != nil {
+		return err
+	}
+
+	scpSession := &scp.Session{
+		PreserveTimes:      a.PreserveTimes,
+		DeltaMinSize:       a.DeltaMinSize,
+		KeepaliveInterval:  a.KeepaliveInterval,
+		KeepaliveMaxMissed: a.KeepaliveMaxMissed,
+	}
+	if err := scpSession.Attach(client); err != nil {
+		client.Close()
+		return err
+	}
+	if scpErr := scpSession.Probe(); scpErr != nil {
+		// The keepalives started by the scp session continue to run on
+		// the shared connection.
+		sftpSession := &sftp.Session{PreserveTimes: a.PreserveTimes}
+		if err := sftpSession.Attach(client); err != nil {
+			client.Close()
+			return fmt.Errorf("neither scp nor sftp is available: %s; %s", scpErr, err)
+		}
+		a.lock.Lock()
+		a.Session = sftpSession
+		a.lock.Unlock()
+		return nil
+	}
+	a.lock.Lock()
+	a.Session = scpSession
+	a.lock.Unlock()
+	a.archive = &Tar{Session: scpSession}
+	return nil
+}
+
+// SendsDeltas reports whether large files are sent as deltas, which is only
+// the case when DeltaMinSize is set and scp is used.
+func (a *Auto) SendsDeltas() bool {
+	return a.archive != nil && a.DeltaMinSize > 0
+}
+
+func (a *Auto) SendFiles(remoteDir, localDir string, paths []string) error {
+	if a.archive != nil && a.large(localDir, paths) {
+		return a.archive.SendFiles(remoteDir, localDir, paths)
+	}
+	return a.Session.SendFiles(remoteDir, localDir, paths)
+}
+
+func (a *Auto) Remove(remoteDir string, paths []string) error {
+	if a.archive != nil && a.ArchiveFiles > 0 && len(paths) > a.ArchiveFiles {
+		return a.archive.Remove(remoteDir, paths)
+	}
+	return a.Session.Remove(remoteDir, paths)
+}
+
+func (a *Auto) large(localDir string, paths []string) bool {
+	if a.ArchiveFiles > 0 && len(paths) > a.ArchiveFiles {
+		return true
+	}
+	if a.ArchiveBytes <= 0 {
+		return false
+	}
+	var size int64
+	for _, relPath := range paths {
+		if info, err := os.Stat(filepath.Join(localDir, filepath.FromSlash(relPath))); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return size > a.ArchiveBytes
+}
+
+// Lost returns a channel that is closed once the connection ends, or nil when
+// the session is not connected.
+func (a *Auto) Lost() <-chan struct{} {
+	if monitored, ok := a.Session.(watch.MonitoredSession); ok {
+		return monitored.Lost()
+	}
+	return nil
+}
+
+func (a *Auto) Close() error {
+	if a.Session == nil {
+		return nil
+	}
+	err := a.Session.Close()
+	a.lock.Lock()
+	a.Session = nil
+	a.lock.Unlock()
+	a.archive = nil
+	return err
+}
+
+// Dial opens a TCP connection from the container to address over the
+// transport in use. Unlike other methods, it may be called while the session
+// is being closed.
+func (a *Auto) Dial(address string) (net.Conn, error) {
+	a.lock.Lock()
+	session := a.Session
+	a.lock.Unlock()
+	if session == nil {
+		return nil, errors.New("session closed")
+	}
+	return session.Dial(address)
+}
+
+// New returns a session for the configured transport: scp, sftp, tar or
+// auto.
+func New(config watch.SessionConfig) watch.Session {
+	var minSize int64
+	if config.Delta {
+		minSize = deltaMinSize
+	}
+
+	switch config.Transport {
+	case "scp":
+		return newSCP(config, minSize)
+	case "sftp":
+		return &sftp.Session{PreserveTimes: true, KeepaliveInterval: config.KeepaliveInterval, KeepaliveMaxMissed: config.KeepaliveMaxMissed}
+	case "tar":
+		return &Tar{Session: newSCP(config, minSize)}
+	}
+	return &Auto{
+		PreserveTimes:      true,
+		ArchiveFiles:       archiveFiles,
+		ArchiveBytes:       archiveBytes,
+		DeltaMinSize:       minSize,
+		KeepaliveInterval:  config.KeepaliveInterval,
+		KeepaliveMaxMissed: config.KeepaliveMaxMissed,
+	}
+}
+
+func newSCP(config watch.SessionConfig, deltaMinSize int64) *scp.Session {
+	return &scp.Session{
+		PreserveTimes:      true,
+		DeltaMinSize:       deltaMinSize,
+		KeepaliveInterval:  config.KeepaliveInterval,
+		KeepaliveMaxMissed: config.KeepaliveMaxMissed,
+	}
+}
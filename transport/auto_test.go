@@ -0,0 +1,203 @@
+package transport_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-watch/scp"
+	"github.com/pivotal-cf/cf-watch/scp/mocks"
+	"github.com/pivotal-cf/cf-watch/sftp"
+	. "github.com/pivotal-cf/cf-watch/transport"
+	"github.com/pivotal-cf/cf-watch/watch"
+)
+
+var _ = Describe("Auto", func() {
+	var (
+		auto          *Auto
+		mockSSHServer *mocks.SSHServer
+		serverAddress string
+		remoteRoot    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		remoteRoot, err = ioutil.TempDir("", "cf-watch-remote")
+		Expect(err).NotTo(HaveOccurred())
+
+		auto = &Auto{PreserveTimes: true}
+		mockSSHServer = &mocks.SSHServer{
+			User:     "some-valid-user",
+			Password: "some-valid-password",
+			SFTPRoot: remoteRoot,
+		}
+		serverAddress = mockSSHServer.Start()
+	})
+
+	AfterEach(func() {
+		mockSSHServer.Stop()
+		Expect(os.RemoveAll(remoteRoot)).To(Succeed())
+	})
+
+	Describe("#Connect", func() {
+		Context("when the container provides scp", func() {
+			It("should use scp", func(done Done) {
+				go func() {
+					defer GinkgoRecover()
+
+					auto.DeltaMinSize = 1 << 20
+					Expect(auto.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					Expect(auto.Session).To(BeAssignableToTypeOf(&scp.Session{}))
+					Expect(auto.SendsDeltas()).To(BeTrue())
+					Expect(auto.Close()).To(Succeed())
+					close(done)
+				}()
+
+				var result string
+				Eventually(mockSSHServer.CommandChan).Should(Receive(&result))
+				Expect(result).To(Equal("test -x /usr/bin/scp"))
+			})
+		})
+
+		Context("when the container does not provide scp", func() {
+			It("should use sftp over the same connection without deltas", func(done Done) {
+				mockSSHServer.CommandExitStatus = 1
+
+				go func() {
+					defer GinkgoRecover()
+
+					auto.DeltaMinSize = 1 << 20
+					Expect(auto.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					Expect(auto.Session).To(BeAssignableToTypeOf(&sftp.Session{}))
+					Expect(auto.SendsDeltas()).To(BeFalse())
+					Expect(auto.List("/home/vcap/app", false)).To(BeEmpty())
+					Expect(auto.Close()).To(Succeed())
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("when the container provides neither", func() {
+			It("should return an error", func(done Done) {
+				mockSSHServer.CommandExitStatus = 1
+				mockSSHServer.SFTPRoot = ""
+
+				go func() {
+					defer GinkgoRecover()
+
+					err := auto.Connect(serverAddress, "some-valid-user", "some-valid-password", "")
+					Expect(err).To(MatchError(HavePrefix("neither scp nor sftp is available: ")))
+					Expect(auto.Session).To(BeNil())
+					close(done)
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive())
+			})
+		})
+
+		Context("with invalid credentials", func() {
+			It("should return an error", func() {
+				err := auto.Connect(serverAddress, "some-invalid-user", "some-invalid-password", "")
+				Expect(err).To(MatchError(ContainSubstring("ssh: unable to authenticate")))
+			})
+		})
+	})
+
+	Context("when connected over scp", func() {
+		var localDir string
+
+		BeforeEach(func() {
+			var err error
+			localDir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "small.go"), []byte("some"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "other.go"), []byte("some"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "third.go"), []byte("some"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(localDir, "large.go"), []byte("some-large-contents"), 0644)).To(Succeed())
+			auto.ArchiveFiles = 2
+			auto.ArchiveBytes = 16
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(localDir)).To(Succeed())
+		})
+
+		DescribeTable("should only send batches over a threshold as a tar stream",
+			func(paths []string, command string) {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+
+					Expect(auto.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer auto.Close()
+					Expect(auto.SendFiles("/home/vcap/app", localDir, paths)).To(Succeed())
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive(Equal("test -x /usr/bin/scp")))
+				Eventually(mockSSHServer.CommandChan).Should(Receive(Equal(command)))
+				Eventually(done).Should(BeClosed())
+			},
+			Entry("with few small files", []string{"small.go", "other.go"}, "mkdir -p -- /home/vcap/app && /usr/bin/scp -tpr /home/vcap"),
+			Entry("with too many files", []string{"small.go", "other.go", "third.go"}, "mkdir -p -- /home/vcap/app && tar -xzf - -C /home/vcap/app"),
+			Entry("with too many bytes", []string{"large.go"}, "mkdir -p -- /home/vcap/app && tar -xzf - -C /home/vcap/app"),
+		)
+
+		DescribeTable("should only send removes over the file threshold as an rm list",
+			func(paths []string, command string) {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+
+					Expect(auto.Connect(serverAddress, "some-valid-user", "some-valid-password", "")).To(Succeed())
+					defer auto.Close()
+					Expect(auto.Remove("/home/vcap/app", paths)).To(Succeed())
+				}()
+
+				Eventually(mockSSHServer.CommandChan).Should(Receive(Equal("test -x /usr/bin/scp")))
+				Eventually(mockSSHServer.CommandChan).Should(Receive(Equal(command)))
+				Eventually(done).Should(BeClosed())
+			},
+			Entry("with few files", []string{"a", "b"}, "rm -rf -- /home/vcap/app/a /home/vcap/app/b"),
+			Entry("with too many files", []string{"a", "b", "c"}, "xargs -0 -r rm -rf --"),
+		)
+	})
+
+	Describe("#Dial", func() {
+		Context("when called on a closed session", func() {
+			It("should return an error", func() {
+				_, err := auto.Dial("localhost:8080")
+				Expect(err).To(MatchError("session closed"))
+			})
+		})
+	})
+
+	Describe("#Close", func() {
+		Context("when called on a closed session", func() {
+			It("should succeed", func() {
+				Expect(auto.Close()).To(Succeed())
+			})
+		})
+	})
+})
+
+var _ = DescribeTable("New",
+	func(config watch.SessionConfig, expected watch.Session) {
+		Expect(New(config)).To(Equal(expected))
+	},
+	Entry("with scp", watch.SessionConfig{Transport: "scp", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &scp.Session{PreserveTimes: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}),
+	Entry("with sftp", watch.SessionConfig{Transport: "sftp", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &sftp.Session{PreserveTimes: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}),
+	Entry("with tar", watch.SessionConfig{Transport: "tar", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &Tar{Session: &scp.Session{PreserveTimes: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}}),
+	Entry("with auto", watch.SessionConfig{Transport: "auto", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &Auto{PreserveTimes: true, ArchiveFiles: 100, ArchiveBytes: 1 << 20, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}),
+	Entry("with scp deltas", watch.SessionConfig{Transport: "scp", Delta: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &scp.Session{PreserveTimes: true, DeltaMinSize: 1 << 20, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}),
+	Entry("with tar deltas", watch.SessionConfig{Transport: "tar", Delta: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &Tar{Session: &scp.Session{PreserveTimes: true, DeltaMinSize: 1 << 20, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}}),
+	Entry("with auto deltas", watch.SessionConfig{Transport: "auto", Delta: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}, &Auto{PreserveTimes: true, ArchiveFiles: 100, ArchiveBytes: 1 << 20, DeltaMinSize: 1 << 20, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}),
+)
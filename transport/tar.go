@@ -0,0 +1,23 @@
+package transport
+
+import "github.com/pivotal-cf/cf-watch/scp"
+
+// Tar is a watch.Session that sends every batch as a single compressed tar
+// stream and removes paths with a single rm list, using scp for everything
+// else. Large files are sent as deltas first if the scp session has a
+// DeltaMinSize.
+type Tar struct {
+	*scp.Session
+}
+
+func (t *Tar) SendFiles(remoteDir, localDir string, paths []string) error {
+	paths = t.Session.SendDeltas(remoteDir, localDir, paths)
+	if len(paths) == 0 {
+		return nil
+	}
+	return t.Session.SendArchive(remoteDir, localDir, paths)
+}
+
+func (t *Tar) Remove(remoteDir string, paths []string) error {
+	return t.Session.RemoveList(remoteDir, paths)
+}
@@ -0,0 +1,154 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// batch collects the changes reported during a burst of events. Each path is
+// recorded once with its latest state, so a file that is saved several times
+// is sent once and a file that is created and removed again is not sent.
+// Renames are kept in order and applied before any removes or sends, with
+// the states of the paths they move carried over to their new paths. The
+// events are kept as well, so that a batch can be merged into another.
+type batch struct {
+	changed map[string]bool
+	renames []Event
+	events  []Event
+
+	// synced is set once an instance has received the whole batch.
+	synced bool
+}
+
+func newBatch() *batch {
+	return &batch{changed: map[string]bool{}}
+}
+
+func (b *batch) add(event Event) {
+	b.events = append(b.events, event)
+	switch event.Op {
+	case Create, Write:
+		if !event.IsDir {
+			b.changed[event.Path] = true
+		}
+	case Remove:
+		b.changed[event.Path] = false
+	case Rename:
+		b.rename(event)
+	}
+}
+
+func (b *batch) rename(event Event) {
+	// A file that changed during this batch may not exist remotely yet, so
+	// it is removed and sent to its new path instead.
+	if !event.IsDir && b.changed[event.OldPath] {
+		b.changed[event.OldPath] = false
+		b.changed[event.Path] = true
+		return
+	}
+
+	moved := map[string]bool{}
+	for relPath, exists := range b.changed {
+		if within(relPath, event.Path) {
+			delete(b.changed, relPath)
+			continue
+		}
+		if within(relPath, event.OldPath) {
+			delete(b.changed, relPath)
+			moved[event.Path+strings.TrimPrefix(relPath, event.OldPath)] = exists
+		}
+	}
+	for relPath, exists := range moved {
+		b.changed[relPath] = exists
+	}
+	b.renames = append(b.renames, event)
+}
+
+// merge adds the events of another batch, as if they had been added after
+// the events of this one.
+func (b *batch) merge(other *batch) {
+	for _, event := range other.events {
+		b.add(event)
+	}
+}
+
+func (b *batch) empty() bool {
+	return len(b.changed) == 0 && len(b.renames) == 0
+}
+
+// sends returns the sorted paths that still exist below localDir. A path may
+// disappear between its last event and the transfer, in which case it is left
+// for the event that reports its removal.
+func (b *batch) sends(localDir string) []string {
+	var paths []string
+	for relPath, exists := range b.changed {
+		if !exists {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(localDir, filepath.FromSlash(relPath))); os.IsNotExist(err) {
+			continue
+		}
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// paths returns the sorted paths that the batch changes, including the new
+// paths of renames.
+func (b *batch) paths() []string {
+	changed := map[string]bool{}
+	for relPath := range b.changed {
+		changed[relPath] = true
+	}
+	for _, rename := range b.renames {
+		changed[rename.Path] = true
+	}
+
+	var paths []string
+	for relPath := range changed {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// removes returns the sorted paths to remove, leaving out any path below a
+// directory that is removed as well.
+func (b *batch) removes() []string {
+	var paths []string
+	for relPath, exists := range b.changed {
+		if exists {
+			continue
+		}
+		covered := false
+		for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+			if exists, ok := b.changed[dir]; ok && !exists {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// within reports whether relPath is dir or a path below it.
+func within(relPath, dir string) bool {
+	return relPath == dir || strings.HasPrefix(relPath, dir+"/")
+}
+
+// describe names a single path, or counts several, for summary lines.
+func describe(paths []string) string {
+	if len(paths) == 1 {
+		return paths[0]
+	}
+	return fmt.Sprintf("%d files", len(paths))
+}
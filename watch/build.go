@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// buildStage is the directory below the remote directory that build
+// artifacts are sent to before they are moved into place, so that files are
+// only replaced once every artifact has arrived, and running binaries are
+// replaced rather than overwritten.
+const buildStage = ".cf-watch-build"
+
+// build holds the artifacts of the last successful --build, which are below
+// buildStage in dir, and whether an instance has received them.
+type build struct {
+	dir    string
+	paths  []string
+	synced bool
+}
+
+// run runs the --build command in the local directory for Linux on amd64,
+// streaming its output. The command writes its artifacts to the directory
+// named by CF_WATCH_BUILD_DIR. If it fails, the artifacts of the previous
+// build are kept.
+func (b *build) run(p *Plugin, opts *options) bool {
+	dir, err := ioutil.TempDir("", "cf-watch-build")
+	if err != nil {
+		p.UI.Warn("Failed to create build directory: %s", err)
+		return false
+	}
+	output := filepath.Join(dir, buildStage)
+
+	p.UI.Say("Building with %s", opts.build)
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/c"}
+	}
+	cmd := exec.Command(shell[0], shell[1], opts.build)
+	cmd.Dir = opts.dir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CF_WATCH_BUILD_DIR="+output)
+	cmd.Stdout = p.Stdout
+	cmd.Stderr = p.Stderr
+	err = os.Mkdir(output, 0755)
+	if err == nil {
+		err = cmd.Run()
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		p.UI.Warn("Build failed: %s", err)
+		return false
+	}
+
+	var paths []string
+	err = filepath.Walk(output, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(output, walkPath)
+		paths = append(paths, filepath.ToSlash(relPath))
+		return err
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		p.UI.Warn("Failed to read build artifacts: %s", err)
+		return false
+	}
+	if len(paths) == 0 {
+		os.RemoveAll(dir)
+		p.UI.Warn("Build wrote no files to CF_WATCH_BUILD_DIR")
+		return false
+	}
+	sort.Strings(paths)
+
+	b.close()
+	b.dir = dir
+	b.paths = paths
+	b.synced = false
+	p.UI.Say("Built %s", describe(paths))
+	return true
+}
+
+func (b *build) close() {
+	if b.dir != "" {
+		os.RemoveAll(b.dir)
+	}
+}
+
+// sendBuild sends the artifacts of the last build to an app instance below
+// buildStage, moves them into place, and then runs afterSync. Nothing is
+// sent before the first successful build, and with --restart the app is
+// started as it was staged instead.
+func (p *Plugin) sendBuild(opts *options, b *build, index int, session Session) error {
+	if b.dir == "" {
+		if opts.restart {
+			return p.restart(opts, index, session)
+		}
+		return nil
+	}
+
+	staged := make([]string, len(b.paths))
+	for i, relPath := range b.paths {
+		staged[i] = path.Join(buildStage, relPath)
+	}
+	if err := session.SendFiles(opts.destination, b.dir, staged); err != nil {
+		return p.warn(err, "Failed to send %s to instance %d: %s", describe(b.paths), index)
+	}
+	for i, relPath := range b.paths {
+		if err := session.Rename(opts.destination, staged[i], relPath); err != nil {
+			return p.warn(err, "Failed to rename %s to %s on instance %d: %s", staged[i], relPath, index)
+		}
+	}
+	if err := session.Remove(opts.destination, []string{buildStage}); err != nil {
+		if err := p.warn(err, "Failed to remove %s from instance %d: %s", buildStage, index); err != nil {
+			return err
+		}
+	}
+
+	p.UI.Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", index, len(b.paths), 0, 0)
+	b.synced = true
+	return p.afterSync(opts, index, session)
+}
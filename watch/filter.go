@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultIgnores are the paths that cf push never uploads.
+var defaultIgnores = []string{
+	".cfignore",
+	"/manifest.yml",
+	".gitignore",
+	".git",
+	".hg",
+	".svn",
+	"_darcs",
+	".DS_Store",
+}
+
+// Filter decides which paths below the watched directory are synced. Patterns
+// follow the .cfignore rules used by cf push: later patterns win, a leading !
+// re-includes a path, a leading / anchors a pattern to the watched directory,
+// and a pattern that matches a directory also matches everything below it.
+type Filter struct {
+	patterns  []ignorePattern
+	reinclude bool
+}
+
+type ignorePattern struct {
+	exclude  bool
+	anchored bool
+	regexps  []*regexp.Regexp
+}
+
+// NewFilter builds a Filter from the default cf push ignores followed by the
+// provided lines, which use .cfignore syntax.
+func NewFilter(lines ...string) *Filter {
+	filter := &Filter{}
+	for _, line := range append(defaultIgnores, lines...) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclude := true
+		if strings.HasPrefix(line, "!") {
+			line = line[1:]
+			exclude = false
+			filter.reinclude = true
+		}
+
+		pattern := path.Clean(line)
+		filter.patterns = append(filter.patterns, ignorePattern{
+			exclude:  exclude,
+			anchored: strings.HasPrefix(pattern, "/"),
+			regexps:  regexpsForPattern(pattern),
+		})
+	}
+	return filter
+}
+
+// LoadFilter reads .cfignore, and .gitignore if requested, from the watched
+// directory. Exclude patterns are applied after the ignore files and include
+// patterns after those, so that an include always wins.
+func LoadFilter(dir string, gitignore bool, include, exclude []string) (*Filter, error) {
+	files := []string{".cfignore"}
+	if gitignore {
+		files = append(files, ".gitignore")
+	}
+
+	var lines []string
+	for _, name := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.Split(string(contents), "\n")...)
+	}
+	lines = append(lines, exclude...)
+	for _, pattern := range include {
+		lines = append(lines, "!"+pattern)
+	}
+	return NewFilter(lines...), nil
+}
+
+// Ignored reports whether a slash-separated path relative to the watched
+// directory should not be synced. A nil Filter ignores nothing.
+func (f *Filter) Ignored(relPath string) bool {
+	if f == nil {
+		return false
+	}
+
+	ignored := false
+	for _, pattern := range f.patterns {
+		candidate := relPath
+		if pattern.anchored {
+			candidate = "/" + relPath
+		}
+		for _, re := range pattern.regexps {
+			if re.MatchString(candidate) {
+				ignored = pattern.exclude
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+// skipsDir reports whether nothing below an ignored directory can be synced,
+// which is the case unless some pattern re-includes paths.
+func (f *Filter) skipsDir(relPath string) bool {
+	return f.Ignored(relPath) && !f.reinclude
+}
+
+func regexpsForPattern(pattern string) []*regexp.Regexp {
+	globs := []string{
+		pattern,
+		path.Join(pattern, "*"),
+		path.Join(pattern, "**", "*"),
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		globs = append(globs,
+			path.Join("**", pattern),
+			path.Join("**", pattern, "*"),
+			path.Join("**", pattern, "**", "*"),
+		)
+	}
+
+	var regexps []*regexp.Regexp
+	for _, glob := range globs {
+		regexps = append(regexps, regexp.MustCompile(globToRegexp(glob)))
+	}
+	return regexps
+}
+
+// globToRegexp translates a glob in which ** matches across directories, *
+// matches within a path segment and ? matches a single character.
+func globToRegexp(glob string) string {
+	var buf bytes.Buffer
+	buf.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			buf.WriteString("[^/]*")
+		case glob[i] == '?':
+			buf.WriteString("[^/]")
+		default:
+			buf.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
@@ -0,0 +1,106 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/pivotal-cf/cf-watch/watch"
+)
+
+var _ = Describe("Filter", func() {
+	Describe("#Ignored", func() {
+		DescribeTable("should follow .cfignore rules",
+			func(lines []string, relPath string, ignored bool) {
+				Expect(NewFilter(lines...).Ignored(relPath)).To(Equal(ignored))
+			},
+			Entry("with an unmatched path", []string{"*.log"}, "some-file", false),
+			Entry("with a default ignore", []string{}, ".git/some-file", true),
+			Entry("with a root manifest", []string{}, "manifest.yml", true),
+			Entry("with a nested manifest", []string{}, "some-dir/manifest.yml", false),
+			Entry("with a matching file name", []string{"*.log"}, "some-file.log", true),
+			Entry("with a matching nested file name", []string{"*.log"}, "some-dir/some-file.log", true),
+			Entry("with a matching directory", []string{"node_modules"}, "some-dir/node_modules/some-module/some-file", true),
+			Entry("with an anchored pattern", []string{"/some-dir"}, "some-dir/some-file", true),
+			Entry("with an anchored pattern below the root", []string{"/some-dir"}, "some-other-dir/some-dir/some-file", false),
+			Entry("with a wildcard that does not cross directories", []string{"/some-*/some-file"}, "some-dir/some-nested-dir/some-file", false),
+			Entry("with a double wildcard", []string{"some-dir/**/some-file"}, "some-dir/some-nested-dir/some-file", true),
+			Entry("with a single character wildcard", []string{"some-file.?"}, "some-file.c", true),
+			Entry("with a trailing slash", []string{"some-dir/"}, "some-dir/some-file", true),
+			Entry("with regexp characters", []string{"some+file"}, "some-file", false),
+			Entry("with a negation", []string{"*.log", "!keep.log"}, "keep.log", false),
+			Entry("with a later exclusion", []string{"!keep.log", "*.log"}, "keep.log", true),
+			Entry("with comments and blank lines", []string{"# some-file", "", "  "}, "some-file", false),
+		)
+
+		It("should ignore nothing when nil", func() {
+			var filter *Filter
+			Expect(filter.Ignored(".git")).To(BeFalse())
+		})
+	})
+
+	Describe("LoadFilter", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "cf-watch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, ".cfignore"), []byte("*.log\n/tmp\n"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.swp\n"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("should read .cfignore", func() {
+			filter, err := LoadFilter(dir, false, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filter.Ignored("some-file.log")).To(BeTrue())
+			Expect(filter.Ignored("tmp/some-file")).To(BeTrue())
+			Expect(filter.Ignored("some-file.swp")).To(BeFalse())
+		})
+
+		It("should read .gitignore when requested", func() {
+			filter, err := LoadFilter(dir, true, nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filter.Ignored("some-file.log")).To(BeTrue())
+			Expect(filter.Ignored("some-file.swp")).To(BeTrue())
+		})
+
+		It("should apply excludes and then includes", func() {
+			filter, err := LoadFilter(dir, false, []string{"important.log", "*.txt"}, []string{"*.txt", "*.tmp"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filter.Ignored("important.log")).To(BeFalse())
+			Expect(filter.Ignored("some-file.txt")).To(BeFalse())
+			Expect(filter.Ignored("some-file.tmp")).To(BeTrue())
+		})
+
+		Context("when there are no ignore files", func() {
+			It("should only apply the defaults", func() {
+				Expect(os.Remove(filepath.Join(dir, ".cfignore"))).To(Succeed())
+				Expect(os.Remove(filepath.Join(dir, ".gitignore"))).To(Succeed())
+
+				filter, err := LoadFilter(dir, true, nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filter.Ignored("some-file.log")).To(BeFalse())
+				Expect(filter.Ignored(".git")).To(BeTrue())
+			})
+		})
+
+		Context("when an ignore file cannot be read", func() {
+			It("should return an error", func() {
+				Expect(os.Remove(filepath.Join(dir, ".cfignore"))).To(Succeed())
+				Expect(os.Mkdir(filepath.Join(dir, ".cfignore"), 0755)).To(Succeed())
+
+				_, err := LoadFilter(dir, false, nil, nil)
+				Expect(err).To(MatchError(ContainSubstring("is a directory")))
+			})
+		})
+	})
+})
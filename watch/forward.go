@@ -0,0 +1,126 @@
+package watch
+
+import (
+	"io"
+	"net"
+)
+
+// forwarder listens on the local ports of -L flags. Accepted connections are
+// handed to the watch loop, which forwards them over the current session of
+// the instance, so that they follow it across reconnects. Connections are
+// dialed in their own goroutines, which hand failures back to the loop.
+type forwarder struct {
+	listeners []net.Listener
+	accepted  chan accepted
+	failed    chan failedForward
+	done      chan struct{}
+}
+
+type accepted struct {
+	conn    net.Conn
+	forward forward
+}
+
+type failedForward struct {
+	forward forward
+	index   int
+	err     error
+}
+
+func listenForwards(forwards []forward) (*forwarder, error) {
+	f := &forwarder{done: make(chan struct{})}
+	if len(forwards) == 0 {
+		return f, nil
+	}
+
+	f.accepted = make(chan accepted)
+	f.failed = make(chan failedForward)
+	for _, fwd := range forwards {
+		listener, err := net.Listen("tcp", fwd.local)
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+		f.listeners = append(f.listeners, listener)
+		go f.accept(listener, fwd)
+	}
+	return f, nil
+}
+
+func (f *forwarder) accept(listener net.Listener, fwd forward) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case f.accepted <- accepted{conn: conn, forward: fwd}:
+		case <-f.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (f *forwarder) close() {
+	close(f.done)
+	for _, listener := range f.listeners {
+		listener.Close()
+	}
+}
+
+// forward connects an accepted connection to its remote address through the
+// instance's session, without holding up the watch loop while the remote
+// address is dialed. Connections accepted while the instance is reconnecting
+// are closed.
+func (p *Plugin) forward(forwards *forwarder, instances *instances, index int, a accepted) {
+	session, ok := instances.sessions[index]
+	if !ok {
+		a.conn.Close()
+		p.UI.Warn("Closed connection to %s while instance %d is reconnecting", a.forward.local, index)
+		return
+	}
+	go forwards.dial(session, index, a)
+}
+
+// dial connects a to its remote address and copies between them. If the
+// address cannot be reached, the failure is handed back to the watch loop
+// before the connection is closed.
+func (f *forwarder) dial(session Session, index int, a accepted) {
+	remote, err := session.Dial(a.forward.remote)
+	if err != nil {
+		select {
+		case f.failed <- failedForward{forward: a.forward, index: index, err: err}:
+		case <-f.done:
+		}
+		a.conn.Close()
+		return
+	}
+	pipe(a.conn, remote)
+}
+
+// pipe copies between two connections until both directions end, passing on
+// the end of each direction as a half-close where possible.
+func pipe(local, remote net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, local)
+		closeWrite(remote)
+		close(done)
+	}()
+	io.Copy(local, remote)
+	closeWrite(local)
+	<-done
+	local.Close()
+	remote.Close()
+}
+
+func closeWrite(conn net.Conn) {
+	if halfCloser, ok := conn.(interface {
+		CloseWrite() error
+	}); ok {
+		halfCloser.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,186 @@
+package watch
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// instances tracks the sessions open to app instances, and the outages of
+// instances whose connections were lost. Every connection uses a fresh
+// one-time SSH code, since codes cannot be reused.
+type instances struct {
+	cli         CLI
+	newSession  func() Session
+	appGUID     string
+	endpoint    string
+	fingerprint string
+	sessions    map[int]Session
+	outages     map[int]*outage
+
+	// resync makes every outage include the initial sync, since an instance
+	// whose connection was lost may have been restarted with the files of
+	// its droplet.
+	resync bool
+
+	// setup prepares each new session before it is used. Its errors are
+	// reported as they are, so they describe what failed.
+	setup func(index int, session Session) error
+
+	// dead receives monitored sessions whose connections end on their own.
+	// Sessions that were replaced or dropped since are ignored.
+	dead chan deadSession
+	stop chan struct{}
+}
+
+type deadSession struct {
+	index   int
+	session Session
+}
+
+// outage describes what an instance missed while it was disconnected: the
+// initial sync, changes, or both.
+type outage struct {
+	sync    bool
+	changes *batch
+}
+
+func (i *instances) connect(index int, fail func(message string, args ...interface{})) bool {
+	passwordOutput, err := i.cli.CliCommandWithoutTerminalOutput("ssh-code")
+	if err != nil {
+		fail("Failed to retrieve SSH code: %s", err)
+		return false
+	}
+
+	session := i.newSession()
+	username := "cf:" + i.appGUID + "/" + strconv.Itoa(index)
+	password := strings.TrimSpace(passwordOutput[0])
+	if err := session.Connect(i.endpoint, username, password, i.fingerprint); err != nil {
+		fail("Failed to connect to app over SSH: %s", err)
+		return false
+	}
+	if i.setup != nil {
+		if err := i.setup(index, session); err != nil {
+			session.Close()
+			fail("%s", err)
+			return false
+		}
+	}
+
+	if i.sessions == nil {
+		i.sessions = map[int]Session{}
+	}
+	i.sessions[index] = session
+	if monitored, ok := session.(MonitoredSession); ok {
+		i.monitor(index, monitored)
+	}
+	return true
+}
+
+func (i *instances) monitor(index int, session MonitoredSession) {
+	if i.dead == nil {
+		i.dead = make(chan deadSession)
+		i.stop = make(chan struct{})
+	}
+	lost, dead, stop := session.Lost(), i.dead, i.stop
+	go func() {
+		select {
+		case <-lost:
+		case <-stop:
+			return
+		}
+		select {
+		case dead <- deadSession{index: index, session: session}:
+		case <-stop:
+		}
+	}()
+}
+
+func (i *instances) running() ([]int, error) {
+	instancesJSONOutput, err := i.cli.CliCommandWithoutTerminalOutput("curl", path.Join("/v2/apps", i.appGUID, "instances"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states map[string]struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal([]byte(instancesJSONOutput[0]), &states); err != nil {
+		return nil, err
+	}
+
+	var indexes []int
+	for key, instance := range states {
+		index, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, err
+		}
+		if instance.State == "RUNNING" {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+func (i *instances) indexes() []int {
+	var indexes []int
+	for index := range i.sessions {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// lose closes the session of an instance whose connection was lost and
+// records what it missed, adding to any outage it is already in.
+func (i *instances) lose(index int, missed outage) {
+	i.drop(index)
+
+	if i.outages == nil {
+		i.outages = map[int]*outage{}
+	}
+	current, ok := i.outages[index]
+	if !ok {
+		current = &outage{changes: newBatch()}
+		i.outages[index] = current
+	}
+	current.sync = current.sync || missed.sync || i.resync
+	if missed.changes != nil {
+		current.changes.merge(missed.changes)
+	}
+}
+
+// queue records a batch for every instance in an outage.
+func (i *instances) queue(pending *batch) {
+	for _, current := range i.outages {
+		current.changes.merge(pending)
+	}
+}
+
+func (i *instances) lost() []int {
+	var indexes []int
+	for index := range i.outages {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (i *instances) drop(index int) {
+	if session, ok := i.sessions[index]; ok {
+		session.Close()
+		delete(i.sessions, index)
+	}
+}
+
+func (i *instances) close() {
+	for index := range i.sessions {
+		i.drop(index)
+	}
+	if i.stop != nil {
+		close(i.stop)
+	}
+}
@@ -0,0 +1,41 @@
+package watch
+
+import (
+	"strings"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// streamLogs subscribes to the app's log stream using the CLI's Doppler
+// endpoint and access token.
+func (p *Plugin) streamLogs(cli CLI, appGUID string, stop <-chan struct{}) (<-chan remote.LogMessage, error) {
+	endpoint, err := cli.DopplerEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	token, err := cli.AccessToken()
+	if err != nil {
+		return nil, err
+	}
+	skipSSLValidation, err := cli.IsSSLDisabled()
+	if err != nil {
+		return nil, err
+	}
+	return p.Logs.Stream(endpoint, token, appGUID, skipSSLValidation, stop)
+}
+
+// showLog shows a log line that passes --log-source. Lines are indented and
+// tagged with their time and source, like in cf logs, so that they stand
+// apart from sync events.
+func (p *Plugin) showLog(opts *options, message remote.LogMessage) {
+	app := strings.HasPrefix(strings.ToUpper(message.Source), "APP")
+	if opts.logSource == "app" && !app || opts.logSource == "platform" && app {
+		return
+	}
+
+	stream := "OUT"
+	if message.Stderr {
+		stream = "ERR"
+	}
+	p.UI.Say("   %s [%s/%s] %s %s", message.Time.Format("15:04:05"), message.Source, message.Instance, stream, strings.TrimRight(message.Message, "\r\n"))
+}
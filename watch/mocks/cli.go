@@ -28,6 +28,17 @@ func (_m *MockCLI) EXPECT() *_MockCLIRecorder {
 	return _m.recorder
 }
 
+func (_m *MockCLI) AccessToken() (string, error) {
+	ret := _m.ctrl.Call(_m, "AccessToken")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCLIRecorder) AccessToken() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AccessToken")
+}
+
 func (_m *MockCLI) CliCommandWithoutTerminalOutput(_param0 ...string) ([]string, error) {
 	_s := []interface{}{}
 	for _, _x := range _param0 {
@@ -42,3 +53,25 @@ func (_m *MockCLI) CliCommandWithoutTerminalOutput(_param0 ...string) ([]string,
 func (_mr *_MockCLIRecorder) CliCommandWithoutTerminalOutput(arg0 ...interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "CliCommandWithoutTerminalOutput", arg0...)
 }
+
+func (_m *MockCLI) DopplerEndpoint() (string, error) {
+	ret := _m.ctrl.Call(_m, "DopplerEndpoint")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCLIRecorder) DopplerEndpoint() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DopplerEndpoint")
+}
+
+func (_m *MockCLI) IsSSLDisabled() (bool, error) {
+	ret := _m.ctrl.Call(_m, "IsSSLDisabled")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockCLIRecorder) IsSSLDisabled() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsSSLDisabled")
+}
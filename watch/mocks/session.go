@@ -5,8 +5,9 @@ package mocks
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	remote "github.com/pivotal-cf/cf-watch/remote"
 	io "io"
-	os "os"
+	net "net"
 )
 
 // Mock of Session interface
@@ -30,22 +31,94 @@ func (_m *MockSession) EXPECT() *_MockSessionRecorder {
 	return _m.recorder
 }
 
-func (_m *MockSession) Connect(_param0 string, _param1 string, _param2 string) error {
-	ret := _m.ctrl.Call(_m, "Connect", _param0, _param1, _param2)
+func (_m *MockSession) Close() error {
+	ret := _m.ctrl.Call(_m, "Close")
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockSessionRecorder) Connect(arg0, arg1, arg2 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Connect", arg0, arg1, arg2)
+func (_mr *_MockSessionRecorder) Close() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Close")
 }
 
-func (_m *MockSession) Send(_param0 string, _param1 io.ReadCloser, _param2 os.FileMode, _param3 int64) error {
-	ret := _m.ctrl.Call(_m, "Send", _param0, _param1, _param2, _param3)
+func (_m *MockSession) Connect(_param0 string, _param1 string, _param2 string, _param3 string) error {
+	ret := _m.ctrl.Call(_m, "Connect", _param0, _param1, _param2, _param3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-func (_mr *_MockSessionRecorder) Send(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
-	return _mr.mock.ctrl.RecordCall(_mr.mock, "Send", arg0, arg1, arg2, arg3)
+func (_mr *_MockSessionRecorder) Connect(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Connect", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockSession) Dial(_param0 string) (net.Conn, error) {
+	ret := _m.ctrl.Call(_m, "Dial", _param0)
+	ret0, _ := ret[0].(net.Conn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockSessionRecorder) Dial(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Dial", arg0)
+}
+
+func (_m *MockSession) List(_param0 string, _param1 bool) (map[string]remote.File, error) {
+	ret := _m.ctrl.Call(_m, "List", _param0, _param1)
+	ret0, _ := ret[0].(map[string]remote.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockSessionRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "List", arg0, arg1)
+}
+
+func (_m *MockSession) Receive(_param0 string, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "Receive", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockSessionRecorder) Receive(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Receive", arg0, arg1)
+}
+
+func (_m *MockSession) Remove(_param0 string, _param1 []string) error {
+	ret := _m.ctrl.Call(_m, "Remove", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockSessionRecorder) Remove(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Remove", arg0, arg1)
+}
+
+func (_m *MockSession) Rename(_param0 string, _param1 string, _param2 string) error {
+	ret := _m.ctrl.Call(_m, "Rename", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockSessionRecorder) Rename(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rename", arg0, arg1, arg2)
+}
+
+func (_m *MockSession) Run(_param0 string, _param1 string, _param2 io.Writer, _param3 io.Writer) error {
+	ret := _m.ctrl.Call(_m, "Run", _param0, _param1, _param2, _param3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockSessionRecorder) Run(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Run", arg0, arg1, arg2, arg3)
+}
+
+func (_m *MockSession) SendFiles(_param0 string, _param1 string, _param2 []string) error {
+	ret := _m.ctrl.Call(_m, "SendFiles", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockSessionRecorder) SendFiles(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SendFiles", arg0, arg1, arg2)
 }
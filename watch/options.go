@@ -0,0 +1,243 @@
+package watch
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDestination  = "/home/vcap/app"
+	defaultDebounce     = 200 * time.Millisecond
+	defaultPollInterval = 2 * time.Second
+	liveReloadAddress   = "localhost:35729"
+
+	// Sessions send a keepalive every defaultKeepaliveInterval, and give up
+	// on the connection after defaultKeepaliveMaxMissed unanswered
+	// keepalives in a row, like the ServerAliveInterval and
+	// ServerAliveCountMax options of ssh.
+	defaultKeepaliveInterval  = 30 * time.Second
+	defaultKeepaliveMaxMissed = 3
+
+	usage = "cf watch APP_NAME [LOCAL_DIR] [--destination REMOTE_DIR] [-i INDEX | --all-instances] [--debounce DURATION] [--skip-initial-sync | [--checksum] [--delete]] [--gitignore] [--exclude PATTERN]... [--include PATTERN]... [--transport scp|sftp|tar|auto] [--delta] [--two-way [--poll-interval DURATION]] [--on-sync COMMAND] [--build COMMAND] [--restart] [--logs [--log-source app|platform|all]] [--livereload] [-L [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT]... [--skip-host-validation]"
+)
+
+type options struct {
+	appName            string
+	dir                string
+	destination        string
+	instanceIndex      int
+	allInstances       bool
+	skipHostValidation bool
+	gitignore          bool
+	include            []string
+	exclude            []string
+	debounce           time.Duration
+	skipInitialSync    bool
+	checksum           bool
+	delete             bool
+	transport          string
+	delta              bool
+	onSync             string
+	restart            bool
+	build              string
+	logs               bool
+	logSource          string
+	forwards           []forward
+	liveReload         bool
+	twoWay             bool
+	pollInterval       time.Duration
+
+	// startCommand is the command run under the supervisor with --restart,
+	// which is looked up once connected.
+	startCommand string
+}
+
+// patternList collects the values of a flag that may be repeated.
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *patternList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// forward is a local port forwarded to an address reachable from the
+// container, as with ssh -L.
+type forward struct {
+	local  string
+	remote string
+}
+
+// forwardList collects -L flags, given as
+// [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT.
+type forwardList []forward
+
+func (l *forwardList) String() string {
+	var specs []string
+	for _, f := range *l {
+		specs = append(specs, f.local+":"+f.remote)
+	}
+	return strings.Join(specs, ",")
+}
+
+func (l *forwardList) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) == 3 {
+		parts = append([]string{"localhost"}, parts...)
+	}
+	if len(parts) != 4 || parts[0] == "" || parts[2] == "" || !validPort(parts[1]) || !validPort(parts[3]) {
+		return fmt.Errorf("invalid port forwarding: %s", value)
+	}
+	*l = append(*l, forward{
+		local:  net.JoinHostPort(parts[0], parts[1]),
+		remote: net.JoinHostPort(parts[2], parts[3]),
+	})
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+func newFlagSet(opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.StringVar(&opts.destination, "destination", defaultDestination, "Directory in the app container that LOCAL_DIR is synced to (Default: "+defaultDestination+")")
+	flags.IntVar(&opts.instanceIndex, "i", 0, "Index of the app instance to sync to (Default: 0)")
+	flags.BoolVar(&opts.allInstances, "all-instances", false, "Sync to every running app instance")
+	flags.StringVar(&opts.transport, "transport", "auto", "How files are transferred: scp, sftp, tar, or auto to use scp where available and tar for large batches (Default: auto)")
+	flags.BoolVar(&opts.delta, "delta", false, "Send large changed files as the difference from the copy in the app container")
+	flags.BoolVar(&opts.twoWay, "two-way", false, "Also pull files that change in the app container. A file changed on both sides since it was last synced is reported as a conflict, and neither copy is overwritten until one of them changes again")
+	flags.DurationVar(&opts.pollInterval, "poll-interval", defaultPollInterval, "Time between listings of the app container for changes with --two-way (Default: "+defaultPollInterval.String()+")")
+	flags.StringVar(&opts.onSync, "on-sync", "", "Shell command to run in REMOTE_DIR after each batch of changes is synced, such as kill -HUP 1")
+	flags.StringVar(&opts.build, "build", "", "Shell command to run in LOCAL_DIR with GOOS=linux and GOARCH=amd64 when files change. Only the files that it writes to $CF_WATCH_BUILD_DIR are synced")
+	flags.BoolVar(&opts.restart, "restart", false, "Run the app's start command under a supervisor in the container, and restart it after each sync instead of restaging. Push the app with -u process -c 'sleep infinity' so that its own process leaves the port free")
+	flags.BoolVar(&opts.logs, "logs", false, "Show the app's logs along with sync events")
+	flags.StringVar(&opts.logSource, "log-source", "all", "Which logs to show: app for the app's own output, platform for the router, staging and other components, or all (Default: all)")
+	flags.BoolVar(&opts.liveReload, "livereload", false, "Run a LiveReload server on "+liveReloadAddress+" that reloads connected browsers after each synced batch, or only their stylesheets when only CSS changed. Use a LiveReload browser extension, or add <script src=\"http://"+liveReloadAddress+"/livereload.js\"></script> to the page")
+	flags.Var((*forwardList)(&opts.forwards), "L", "Forward a local port to a port reachable from the app instance, as [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT, for as long as the watch runs (may be repeated)")
+	flags.BoolVar(&opts.skipHostValidation, "skip-host-validation", false, "Skip SSH host key validation (insecure)")
+	flags.DurationVar(&opts.debounce, "debounce", defaultDebounce, "Time to wait for further changes before syncing a batch (Default: "+defaultDebounce.String()+")")
+	flags.BoolVar(&opts.skipInitialSync, "skip-initial-sync", false, "Only send changes made after watching starts")
+	flags.BoolVar(&opts.checksum, "checksum", false, "Compare files by checksum instead of size and modification time during the initial sync")
+	flags.BoolVar(&opts.delete, "delete", false, "Remove files that only exist in the app container during the initial sync")
+	flags.BoolVar(&opts.gitignore, "gitignore", false, "Also skip paths matched by LOCAL_DIR/.gitignore")
+	flags.Var((*patternList)(&opts.exclude), "exclude", "Skip paths matching a .cfignore-style pattern (may be repeated)")
+	flags.Var((*patternList)(&opts.include), "include", "Sync paths matching a .cfignore-style pattern even if they are ignored (may be repeated)")
+	return flags
+}
+
+// parseOptions parses the arguments that follow the command name. Flags may
+// appear before, between or after the positional arguments.
+func parseOptions(args []string) (*options, error) {
+	opts := &options{}
+	flags := newFlagSet(opts)
+
+	var positional []string
+	set := map[string]bool{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		flags.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch len(positional) {
+	case 0:
+		return nil, errors.New("APP_NAME is required")
+	case 1:
+		opts.appName = positional[0]
+		opts.dir = "."
+	case 2:
+		opts.appName = positional[0]
+		opts.dir = positional[1]
+	default:
+		return nil, fmt.Errorf("unexpected argument: %s", positional[2])
+	}
+
+	if info, err := os.Stat(opts.dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("LOCAL_DIR %s is not a directory", opts.dir)
+	}
+	if !path.IsAbs(opts.destination) || path.Clean(opts.destination) == "/" {
+		return nil, errors.New("destination must be an absolute path below /")
+	}
+	opts.destination = path.Clean(opts.destination)
+	if opts.instanceIndex < 0 {
+		return nil, errors.New("instance index must not be negative")
+	}
+	if opts.transport != "scp" && opts.transport != "sftp" && opts.transport != "tar" && opts.transport != "auto" {
+		return nil, fmt.Errorf("unknown transport: %s", opts.transport)
+	}
+	if opts.delta && opts.transport == "sftp" {
+		return nil, errors.New("--delta cannot be used with --transport sftp")
+	}
+	if opts.debounce < 0 {
+		return nil, errors.New("debounce must not be negative")
+	}
+	if opts.skipInitialSync && (opts.checksum || opts.delete) {
+		return nil, errors.New("--checksum and --delete cannot be used with --skip-initial-sync")
+	}
+	if opts.build != "" && (opts.checksum || opts.delete) {
+		return nil, errors.New("--checksum and --delete cannot be used with --build")
+	}
+	if opts.logSource != "app" && opts.logSource != "platform" && opts.logSource != "all" {
+		return nil, fmt.Errorf("unknown log source: %s", opts.logSource)
+	}
+	if set["log-source"] && !opts.logs {
+		return nil, errors.New("--log-source requires --logs")
+	}
+	if opts.allInstances && set["i"] {
+		return nil, errors.New("-i and --all-instances cannot be used together")
+	}
+	if opts.allInstances && len(opts.forwards) > 0 {
+		return nil, errors.New("-L cannot be used with --all-instances")
+	}
+	if opts.twoWay && opts.allInstances {
+		return nil, errors.New("--two-way cannot be used with --all-instances")
+	}
+	if opts.twoWay && opts.build != "" {
+		return nil, errors.New("--two-way cannot be used with --build")
+	}
+	if set["poll-interval"] && !opts.twoWay {
+		return nil, errors.New("--poll-interval requires --two-way")
+	}
+	if opts.pollInterval <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+
+	return opts, nil
+}
+
+// usageOptions describes the flags for `cf help watch`. The CLI prefixes
+// every option with a dash, so long flags are listed with one more.
+func usageOptions() map[string]string {
+	details := map[string]string{}
+	newFlagSet(&options{}).VisitAll(func(f *flag.Flag) {
+		name := f.Name
+		if len(name) > 1 {
+			name = "-" + name
+		}
+		details[name] = f.Usage
+	})
+	return details
+}
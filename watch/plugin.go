@@ -2,105 +2,667 @@ package watch
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/cloudfoundry/cli/plugin"
+
+	"github.com/pivotal-cf/cf-watch/remote"
 )
 
 //go:generate mockgen -package mocks -destination mocks/session.go github.com/pivotal-cf/cf-watch/watch Session
 type Session interface {
-	Connect(endpoint, guid, password string) error
-	Send(path string, contents io.ReadCloser, mode os.FileMode, size int64) error
+	Connect(endpoint, username, password, hostKeyFingerprint string) error
+	SendFiles(remoteDir, localDir string, paths []string) error
+	Remove(remoteDir string, paths []string) error
+	Rename(remoteDir, oldPath, newPath string) error
+	List(remoteDir string, checksum bool) (map[string]remote.File, error)
+	Run(remoteDir, command string, stdout, stderr io.Writer) error
+	Dial(address string) (net.Conn, error)
+	Receive(remotePath, localPath string) error
+	Close() error
+}
+
+// RemoteError is implemented by Session errors that carry a message reported
+// by the app container, which is shown to the user as-is.
+type RemoteError interface {
+	error
+	Fatal() bool
+}
+
+// SessionConfig selects how a Session transfers files. Transport is scp,
+// sftp, tar or auto. Delta enables sending large changed files as the
+// difference from their remote copies. A keepalive is sent every
+// KeepaliveInterval, and the connection is closed after KeepaliveMaxMissed
+// of them in a row go unanswered.
+type SessionConfig struct {
+	Transport          string
+	Delta              bool
+	KeepaliveInterval  time.Duration
+	KeepaliveMaxMissed int
+}
+
+// ConnectionError is implemented by Session errors caused by a lost
+// connection. The session is then replaced by a new one, connected with a
+// fresh SSH code.
+type ConnectionError interface {
+	error
+	Disconnected() bool
+}
+
+// MonitoredSession is implemented by sessions that notice a dead connection
+// on their own. The channel returned by Lost is closed once the connection
+// ends, so that the session can be reconnected before it is next used.
+type MonitoredSession interface {
+	Session
+	Lost() <-chan struct{}
+}
+
+// DeltaSession is implemented by sessions that choose their transport once
+// connected. SendsDeltas reports whether the chosen transport sends deltas,
+// since a fallback transport may not support them.
+type DeltaSession interface {
+	Session
+	SendsDeltas() bool
 }
 
 //go:generate mockgen -package mocks -destination mocks/cli.go github.com/pivotal-cf/cf-watch/watch CLI
 type CLI interface {
 	CliCommandWithoutTerminalOutput(args ...string) ([]string, error)
+	DopplerEndpoint() (string, error)
+	AccessToken() (string, error)
+	IsSSLDisabled() (bool, error)
 }
 
 //go:generate mockgen -package mocks -destination mocks/ui.go github.com/pivotal-cf/cf-watch/watch UI
 type UI interface {
+	Say(message string, args ...interface{})
+	Warn(message string, args ...interface{})
 	Failed(message string, args ...interface{})
 }
 
+//go:generate mockgen -package mocks -destination mocks/watcher.go github.com/pivotal-cf/cf-watch/watch Watcher
+type Watcher interface {
+	Watch(dir string, filter *Filter, stop <-chan struct{}) (<-chan Event, error)
+}
+
+//go:generate mockgen -package mocks -destination mocks/log_streamer.go github.com/pivotal-cf/cf-watch/watch LogStreamer
+type LogStreamer interface {
+	Stream(endpoint, token, appGUID string, skipSSLValidation bool, stop <-chan struct{}) (<-chan remote.LogMessage, error)
+}
+
+//go:generate mockgen -package mocks -destination mocks/reloader.go github.com/pivotal-cf/cf-watch/watch Reloader
+type Reloader interface {
+	Reload(paths []string)
+	Close() error
+}
+
+// Reconnect attempts start after minReconnectDelay and back off exponentially
+// up to maxReconnectDelay while they fail.
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
 type Plugin struct {
-	Session Session
-	UI      UI
+	NewSession  func(config SessionConfig) Session
+	UI          UI
+	Watcher     Watcher
+	Logs        LogStreamer
+	NewReloader func(address string) (Reloader, error)
+	Interrupt   <-chan os.Signal
+	Refresh     <-chan time.Time
+	After       func(d time.Duration) <-chan time.Time
+	Stdout      io.Writer
+	Stderr      io.Writer
 }
 
 func (p *Plugin) Run(cliConnection plugin.CliConnection, args []string) {
 	var cli CLI = cliConnection
 
-	appGUIDOutput, err := cli.CliCommandWithoutTerminalOutput("app", args[1], "--guid")
+	// The CLI runs the plugin with only this argument when it is uninstalled.
+	if len(args) > 0 && args[0] == "CLI-MESSAGE-UNINSTALL" {
+		return
+	}
+
+	if len(args) > 1 && args[1] == "pull" {
+		p.pull(cli, args[2:])
+		return
+	}
+
+	opts, err := parseOptions(args[1:])
 	if err != nil {
-		p.UI.Failed("Failed to retrieve app GUID: %s", err)
+		p.UI.Failed("Incorrect usage: %s\n\nUSAGE:\n   %s", err, usage)
 		return
 	}
-	appGUID := strings.TrimSpace(appGUIDOutput[0])
 
-	appJSONOutput, err := cli.CliCommandWithoutTerminalOutput("curl", path.Join("/v2/apps", appGUID))
+	filter, err := LoadFilter(opts.dir, opts.gitignore, opts.include, opts.exclude)
 	if err != nil {
-		p.UI.Failed("Failed to retrieve app info: %s", err)
+		p.UI.Failed("Failed to read ignore file: %s", err)
 		return
 	}
 
-	var appInfo struct{ Entity struct{ Instances int } }
-	if err := json.Unmarshal([]byte(appJSONOutput[0]), &appInfo); err != nil {
-		p.UI.Failed("Failed to parse app info JSON: %s", err)
+	appGUID, app, ok := p.lookupApp(cli, opts.appName)
+	if !ok {
 		return
 	}
+	if !opts.allInstances && (opts.instanceIndex < 0 || opts.instanceIndex >= app.Instances) {
+		p.UI.Failed("App does not have an instance with index %d.", opts.instanceIndex)
+		return
+	}
+	endpoint, hostKeyFingerprint, ok := p.lookupSSH(cli, opts.skipHostValidation)
+	if !ok {
+		return
+	}
+
+	instances := &instances{
+		cli: cli,
+		newSession: func() Session {
+			return p.NewSession(SessionConfig{
+				Transport:          opts.transport,
+				Delta:              opts.delta,
+				KeepaliveInterval:  defaultKeepaliveInterval,
+				KeepaliveMaxMissed: defaultKeepaliveMaxMissed,
+			})
+		},
+		appGUID:     appGUID,
+		endpoint:    endpoint,
+		fingerprint: hostKeyFingerprint,
+		resync:      !opts.skipInitialSync,
+	}
+	defer instances.close()
+
+	// Deltas that cannot be sent because an instance lacks scp are only
+	// reported for the first such instance. The supervisor runs the start
+	// command of the droplet, or else the one set for the app, since apps
+	// that use it are pushed with a placeholder. The app is started by the
+	// sync that follows each connection, or here if there is none.
+	warnedDeltas := false
+	instances.setup = func(index int, session Session) error {
+		if delta, ok := session.(DeltaSession); ok && opts.delta && !delta.SendsDeltas() && !warnedDeltas {
+			p.UI.Warn("Instance %d does not provide scp, so --delta is ignored and files are sent over sftp in full", index)
+			warnedDeltas = true
+		}
+		if !opts.restart {
+			return nil
+		}
+		stagedCommand, err := installSupervisor(session, opts.destination)
+		if err != nil {
+			return fmt.Errorf("Failed to install supervisor: %s", err)
+		}
+		for _, command := range []string{opts.startCommand, stagedCommand, app.Command, app.DetectedStartCommand} {
+			if command != "" {
+				opts.startCommand = command
+				break
+			}
+		}
+		if opts.startCommand == "" {
+			return errors.New("Failed to install supervisor: no start command found in staging_info.yml or the app")
+		}
+		if opts.skipInitialSync {
+			return p.restart(opts, index, session)
+		}
+		return nil
+	}
+
+	if opts.allInstances {
+		p.connectRunning(instances)
+		if len(instances.sessions) == 0 {
+			p.UI.Failed("Failed to connect to any running instance of the app.")
+			return
+		}
+	} else if !instances.connect(opts.instanceIndex, p.UI.Failed) {
+		return
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	events, err := p.Watcher.Watch(opts.dir, filter, stop)
+	if err != nil {
+		p.UI.Failed("Failed to watch directory: %s", err)
+		return
+	}
+
+	var logs <-chan remote.LogMessage
+	if opts.logs {
+		if logs, err = p.streamLogs(cli, appGUID, stop); err != nil {
+			p.UI.Failed("Failed to stream app logs: %s", err)
+			return
+		}
+	}
 
-	if appInfo.Entity.Instances != 1 {
-		p.UI.Failed("App must have exactly one instance to be used with cf-watch.")
+	forwards, err := listenForwards(opts.forwards)
+	if err != nil {
+		p.UI.Failed("Failed to forward local port: %s", err)
 		return
 	}
+	defer forwards.close()
+	for _, f := range opts.forwards {
+		p.UI.Say("Forwarding %s to %s on instance %d", f.local, f.remote, opts.instanceIndex)
+	}
+
+	var reloader Reloader
+	if opts.liveReload {
+		if reloader, err = p.NewReloader(liveReloadAddress); err != nil {
+			p.UI.Failed("Failed to start LiveReload server: %s", err)
+			return
+		}
+		defer reloader.Close()
+		p.UI.Say("LiveReload server listening on %s", liveReloadAddress)
+	}
 
+	// The directory is watched before the initial sync so that changes made
+	// during the sync are picked up afterwards. With --build, instances are
+	// synced by sending the artifacts of the last build instead.
+	sync := func(index int, session Session) error {
+		return p.initialSync(opts, filter, index, session)
+	}
+	built := &build{}
+	defer built.close()
+	if opts.build != "" {
+		sync = func(index int, session Session) error {
+			return p.sendBuild(opts, built, index, session)
+		}
+		if !opts.skipInitialSync {
+			built.run(p, opts)
+		}
+	}
+	// With --two-way, the initial sync is followed by listing both sides, so
+	// that later changes on either side can be told apart. Each new
+	// connection starts over with an initial sync, since the container may
+	// have been restarted in the meantime.
+	state := &twoWay{}
+	if opts.twoWay {
+		initialSync := sync
+		sync = func(index int, session Session) error {
+			if state.session != session {
+				state.session, state.synced = session, nil
+			}
+			if state.synced == nil && !opts.skipInitialSync {
+				if err := initialSync(index, session); err != nil {
+					return err
+				}
+			}
+			return p.reconcile(opts, filter, state, index, session)
+		}
+	}
+	if (!opts.skipInitialSync || opts.twoWay) && !p.each(opts, instances, instances.indexes(), sync, outage{sync: true}) {
+		return
+	}
+
+	p.UI.Say("Watching %s for changes...", opts.dir)
+
+	// Events are collected until none arrive for the debounce period, and
+	// each batch is then sent to every instance in one transfer. Batches are
+	// queued for instances that are reconnecting. With --build, each batch
+	// triggers a build, and its artifacts are sent instead.
+	pending := newBatch()
+	send := func(index int, session Session) error {
+		return p.send(opts, pending, index, session)
+	}
+	flush := func() bool {
+		if opts.twoWay {
+			ok := p.each(opts, instances, instances.indexes(), sync, outage{sync: true})
+			if reloader != nil && len(state.changed) > 0 {
+				reloader.Reload(state.changed)
+			}
+			return ok
+		}
+		if opts.build != "" {
+			if !built.run(p, opts) {
+				return true
+			}
+			ok := p.each(opts, instances, instances.indexes(), sync, outage{sync: true})
+			if reloader != nil && built.synced {
+				reloader.Reload(built.paths)
+			}
+			return ok
+		}
+		instances.queue(pending)
+		ok := p.each(opts, instances, instances.indexes(), send, outage{changes: pending})
+		if reloader != nil && pending.synced {
+			reloader.Reload(pending.paths())
+		}
+		return ok
+	}
+	var quiet, retry, logRetry, poll <-chan time.Time
+	if opts.twoWay {
+		poll = p.After(opts.pollInterval)
+	}
+	delay := minReconnectDelay
+	for {
+		if retry == nil && len(instances.outages) > 0 {
+			p.UI.Say("Reconnecting in %s...", delay)
+			retry = p.After(delay)
+		}
+
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if !pending.empty() {
+					flush()
+				}
+				return
+			}
+			pending.add(event)
+			quiet = p.After(opts.debounce)
+		case <-quiet:
+			quiet = nil
+			if pending.empty() {
+				continue
+			}
+			if !flush() {
+				return
+			}
+			pending = newBatch()
+		case <-poll:
+			if !flush() {
+				return
+			}
+			pending = newBatch()
+			poll = p.After(opts.pollInterval)
+		case <-retry:
+			retry = nil
+			if !p.reconnect(opts, instances, sync) {
+				return
+			}
+			if len(instances.outages) == 0 {
+				delay = minReconnectDelay
+			} else if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		case dead := <-instances.dead:
+			if instances.sessions[dead.index] == dead.session {
+				p.UI.Warn("Lost connection to instance %d", dead.index)
+				instances.lose(dead.index, outage{})
+			}
+		case message, ok := <-logs:
+			if !ok {
+				logs = nil
+				p.UI.Warn("App log stream ended. Reconnecting in %s...", minReconnectDelay)
+				logRetry = p.After(minReconnectDelay)
+				continue
+			}
+			p.showLog(opts, message)
+		case <-logRetry:
+			logRetry = nil
+			if logs, err = p.streamLogs(cli, appGUID, stop); err != nil {
+				p.UI.Warn("Failed to stream app logs: %s. Retrying in %s...", err, minReconnectDelay)
+				logRetry = p.After(minReconnectDelay)
+			}
+		case a := <-forwards.accepted:
+			p.forward(forwards, instances, opts.instanceIndex, a)
+		case failed := <-forwards.failed:
+			p.UI.Warn("Failed to forward %s to %s on instance %d: %s", failed.forward.local, failed.forward.remote, failed.index, failed.err)
+		case <-p.Refresh:
+			if !opts.allInstances {
+				continue
+			}
+			connected := p.connectRunning(instances)
+			if !opts.skipInitialSync || opts.build != "" {
+				p.each(opts, instances, connected, sync, outage{sync: true})
+			}
+		case <-p.Interrupt:
+			p.UI.Say("Stopped watching %s.", opts.dir)
+			return
+		}
+	}
+}
+
+// appInfo is the part of the app's Cloud Controller entity that is used.
+type appInfo struct {
+	Instances            int
+	Command              string
+	DetectedStartCommand string `json:"detected_start_command"`
+}
+
+// lookupApp retrieves the GUID and info of the named app, showing a failure
+// and returning false if either cannot be retrieved.
+func (p *Plugin) lookupApp(cli CLI, appName string) (string, *appInfo, bool) {
+	appGUIDOutput, err := cli.CliCommandWithoutTerminalOutput("app", appName, "--guid")
+	if err != nil {
+		p.UI.Failed("Failed to retrieve app GUID: %s", err)
+		return "", nil, false
+	}
+	appGUID := strings.TrimSpace(appGUIDOutput[0])
+
+	appJSONOutput, err := cli.CliCommandWithoutTerminalOutput("curl", path.Join("/v2/apps", appGUID))
+	if err != nil {
+		p.UI.Failed("Failed to retrieve app info: %s", err)
+		return "", nil, false
+	}
+
+	var app struct {
+		Entity appInfo
+	}
+	if err := json.Unmarshal([]byte(appJSONOutput[0]), &app); err != nil {
+		p.UI.Failed("Failed to parse app info JSON: %s", err)
+		return "", nil, false
+	}
+	return appGUID, &app.Entity, true
+}
+
+// lookupSSH retrieves the SSH endpoint and the host key fingerprint to
+// validate it with, which is empty if validation is skipped. It shows a
+// failure and returns false if neither validation nor skipping is possible.
+func (p *Plugin) lookupSSH(cli CLI, skipHostValidation bool) (string, string, bool) {
 	infoJSONOutput, err := cli.CliCommandWithoutTerminalOutput("curl", "/v2/info")
 	if err != nil {
 		p.UI.Failed("Failed to retrieve CC info: %s", err)
-		return
+		return "", "", false
 	}
 
 	var info struct {
-		AppSSHEndpoint string `json:"app_ssh_endpoint"`
+		AppSSHEndpoint           string `json:"app_ssh_endpoint"`
+		AppSSHHostKeyFingerprint string `json:"app_ssh_host_key_fingerprint"`
 	}
 	if err := json.Unmarshal([]byte(infoJSONOutput[0]), &info); err != nil {
 		p.UI.Failed("Failed to parse CC info JSON: %s", err)
-		return
+		return "", "", false
 	}
 
-	passwordOutput, err := cli.CliCommandWithoutTerminalOutput("ssh-code")
-	if err != nil {
-		p.UI.Failed("Failed to retrieve SSH code: %s", err)
-		return
+	hostKeyFingerprint := info.AppSSHHostKeyFingerprint
+	if skipHostValidation {
+		p.UI.Warn("WARNING: Skipping SSH host key validation. Your SSH code and app files may be sent to an untrusted host.")
+		hostKeyFingerprint = ""
+	} else if hostKeyFingerprint == "" {
+		p.UI.Failed("CC info does not include an SSH host key fingerprint. Use --skip-host-validation to connect without validating the host key.")
+		return "", "", false
 	}
+	return info.AppSSHEndpoint, hostKeyFingerprint, true
+}
 
-	username := fmt.Sprintf("cf:%s/0", appGUID)
-	password := strings.TrimSpace(passwordOutput[0])
-	if err := p.Session.Connect(info.AppSSHEndpoint, username, password); err != nil {
-		p.UI.Failed("Failed to connect to app over SSH: %s", err)
-		return
+// each applies f to the listed instances. Instances whose connections are
+// lost are reconnected later, and then catch up on what f missed. Instances
+// that report a fatal error are disconnected when watching all instances;
+// otherwise the error is shown as a failure and false is returned.
+func (p *Plugin) each(opts *options, instances *instances, indexes []int, f func(index int, session Session) error, missed outage) bool {
+	for _, index := range indexes {
+		err := f(index, instances.sessions[index])
+		if err == nil {
+			continue
+		}
+		if connErr, ok := err.(ConnectionError); ok && connErr.Disconnected() {
+			p.UI.Warn("Lost connection to instance %d: %s", index, err)
+			instances.lose(index, missed)
+			continue
+		}
+		if !opts.allInstances {
+			p.UI.Failed("%s", err)
+			return false
+		}
+		p.UI.Warn("Disconnecting from instance %d: %s", index, err)
+		instances.drop(index)
 	}
+	return true
+}
 
-	file, err := os.Open(args[2])
-	if err != nil {
-		p.UI.Failed("Failed to open file: %s", err)
-		return
+// reconnect connects every instance in an outage with a fresh SSH code and
+// catches it up on what it missed, using sync if it missed a sync. Instances
+// that cannot be reconnected stay in their outage. It returns false if an
+// instance reported a fatal error that ends watching.
+func (p *Plugin) reconnect(opts *options, instances *instances, sync func(index int, session Session) error) bool {
+	for _, index := range instances.lost() {
+		missed := instances.outages[index]
+		fail := func(message string, args ...interface{}) {
+			p.UI.Warn("Instance %d: "+message, append([]interface{}{index}, args...)...)
+		}
+		if !instances.connect(index, fail) {
+			continue
+		}
+		delete(instances.outages, index)
+		p.UI.Say("Reconnected to instance %d", index)
+
+		catchUp := func(index int, session Session) error {
+			if missed.sync {
+				if err := sync(index, session); err != nil {
+					return err
+				}
+			}
+			if missed.changes.empty() {
+				return nil
+			}
+			return p.send(opts, missed.changes, index, session)
+		}
+		if !p.each(opts, instances, []int{index}, catchUp, *missed) {
+			return false
+		}
 	}
+	return true
+}
 
-	fileInfo, err := file.Stat()
+// connectRunning connects to running instances that are not yet connected and
+// disconnects from instances that are no longer running. It returns the
+// indexes of the newly connected instances. Instances in an outage are left
+// to reconnect, unless they are no longer running.
+func (p *Plugin) connectRunning(instances *instances) []int {
+	running, err := instances.running()
 	if err != nil {
-		p.UI.Failed("Failed to stat file: %s", err)
-		return
+		p.UI.Warn("Failed to retrieve app instances: %s", err)
+		return nil
 	}
-	if err := p.Session.Send("/tmp/watch", file, 0644, fileInfo.Size()); err != nil {
-		p.UI.Failed("Failed to send data to app over SSH: %s", err)
-		return
+
+	var connected []int
+	isRunning := map[int]bool{}
+	for _, index := range running {
+		isRunning[index] = true
+		if _, ok := instances.sessions[index]; ok {
+			continue
+		}
+		if _, ok := instances.outages[index]; ok {
+			continue
+		}
+		fail := func(message string, args ...interface{}) {
+			p.UI.Warn("Instance %d: "+message, append([]interface{}{index}, args...)...)
+		}
+		if instances.connect(index, fail) {
+			p.UI.Say("Connected to instance %d", index)
+			connected = append(connected, index)
+		}
+	}
+	for _, index := range instances.indexes() {
+		if !isRunning[index] {
+			instances.drop(index)
+			p.UI.Say("Disconnected from instance %d, which is no longer running", index)
+		}
+	}
+	for _, index := range instances.lost() {
+		if !isRunning[index] {
+			delete(instances.outages, index)
+			p.UI.Say("Stopped reconnecting to instance %d, which is no longer running", index)
+		}
+	}
+	return connected
+}
+
+// send applies a batch to an app instance: renames first, then removals in
+// one exec, then changed files in one transfer, and shows one summary line
+// for whatever succeeded. If all of them succeed, afterSync is run. Only
+// fatal errors reported by the container are returned; anything else is
+// shown as a warning so that watching can continue.
+func (p *Plugin) send(opts *options, pending *batch, index int, session Session) error {
+	synced := true
+	warn := func(err error, message string, args ...interface{}) error {
+		synced = false
+		return p.warn(err, message, args...)
+	}
+
+	var renamed, removed, sent int
+	for _, rename := range pending.renames {
+		err := session.Rename(opts.destination, rename.OldPath, rename.Path)
+		if err == nil {
+			renamed++
+		} else if err := warn(err, "Failed to rename %s to %s on instance %d: %s", rename.OldPath, rename.Path, index); err != nil {
+			return err
+		}
+	}
+
+	if paths := pending.removes(); len(paths) > 0 {
+		err := session.Remove(opts.destination, paths)
+		if err == nil {
+			removed = len(paths)
+		} else if err := warn(err, "Failed to remove %s from instance %d: %s", describe(paths), index); err != nil {
+			return err
+		}
+	}
+
+	if paths := pending.sends(opts.dir); len(paths) > 0 {
+		err := session.SendFiles(opts.destination, opts.dir, paths)
+		if err == nil {
+			sent = len(paths)
+		} else if err := warn(err, "Failed to send %s to instance %d: %s", describe(paths), index); err != nil {
+			return err
+		}
+	}
+
+	if renamed+removed+sent > 0 {
+		p.UI.Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", index, sent, removed, renamed)
+	}
+	if !synced {
+		return nil
+	}
+	pending.synced = true
+	return p.afterSync(opts, index, session)
+}
+
+// afterSync runs the --on-sync command and then restarts the app under the
+// supervisor with --restart, once an instance is synced without errors. The
+// app is not restarted if the command fails.
+func (p *Plugin) afterSync(opts *options, index int, session Session) error {
+	if opts.onSync != "" {
+		p.UI.Say("Running %s on instance %d", opts.onSync, index)
+		if err := session.Run(opts.destination, opts.onSync, p.Stdout, p.Stderr); err != nil {
+			return p.warn(err, "Command %s failed on instance %d: %s", opts.onSync, index)
+		}
+	}
+	if opts.restart {
+		return p.restart(opts, index, session)
+	}
+	return nil
+}
+
+// warn shows a Session error as a warning, using the message reported by the
+// container if there is one. Fatal container errors and lost connections are
+// returned instead.
+func (p *Plugin) warn(err error, message string, args ...interface{}) error {
+	if connErr, ok := err.(ConnectionError); ok && connErr.Disconnected() {
+		return err
+	}
+	if remoteErr, ok := err.(RemoteError); ok {
+		if remoteErr.Fatal() {
+			return remoteErr
+		}
+		p.UI.Warn("%s", remoteErr)
+		return nil
 	}
+	p.UI.Warn(message, append(args, err)...)
+	return nil
 }
 
 func (*Plugin) GetMetadata() plugin.PluginMetadata {
@@ -108,7 +670,12 @@ func (*Plugin) GetMetadata() plugin.PluginMetadata {
 		Name: "Watch",
 		Commands: []plugin.Command{
 			plugin.Command{
-				Name: "watch",
+				Name:     "watch",
+				HelpText: "Sync local changes to a running app's container as they happen, or pull files from it",
+				UsageDetails: plugin.Usage{
+					Usage:   usage + "\n   " + pullUsage,
+					Options: usageOptions(),
+				},
 			},
 		},
 	}
@@ -2,14 +2,23 @@ package watch_test
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"time"
 
 	cliplugin "github.com/cloudfoundry/cli/plugin"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 
+	"github.com/pivotal-cf/cf-watch/remote"
+	"github.com/pivotal-cf/cf-watch/scp"
 	. "github.com/pivotal-cf/cf-watch/watch"
 	"github.com/pivotal-cf/cf-watch/watch/mocks"
 )
@@ -23,6 +32,24 @@ type mockCLIWrapper struct {
 	cliConnectionWrapper
 }
 
+type monitoredSession struct {
+	*mocks.MockSession
+	lost chan struct{}
+}
+
+func (m *monitoredSession) Lost() <-chan struct{} {
+	return m.lost
+}
+
+type deltaSession struct {
+	*mocks.MockSession
+	deltas bool
+}
+
+func (d *deltaSession) SendsDeltas() bool {
+	return d.deltas
+}
+
 var _ = Describe("Plugin", func() {
 	var (
 		plugin      *Plugin
@@ -30,6 +57,9 @@ var _ = Describe("Plugin", func() {
 		mockSession *mocks.MockSession
 		mockCLI     *mockCLIWrapper
 		mockUI      *mocks.MockUI
+		mockWatcher *mocks.MockWatcher
+		interrupt   chan os.Signal
+		quiet       chan time.Time
 	)
 
 	BeforeEach(func() {
@@ -37,9 +67,21 @@ var _ = Describe("Plugin", func() {
 		mockSession = mocks.NewMockSession(mockCtrl)
 		mockCLI = &mockCLIWrapper{MockCLI: mocks.NewMockCLI(mockCtrl)}
 		mockUI = mocks.NewMockUI(mockCtrl)
+		mockWatcher = mocks.NewMockWatcher(mockCtrl)
+		interrupt = make(chan os.Signal, 1)
+		quiet = make(chan time.Time)
 		plugin = &Plugin{
-			Session: mockSession,
-			UI:      mockUI,
+			NewSession: func(config SessionConfig) Session {
+				Expect(config).To(Equal(SessionConfig{Transport: "auto", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}))
+				return mockSession
+			},
+			UI:        mockUI,
+			Watcher:   mockWatcher,
+			Interrupt: interrupt,
+			After: func(d time.Duration) <-chan time.Time {
+				Expect(d).To(Equal(200 * time.Millisecond))
+				return quiet
+			},
 		}
 	})
 
@@ -48,20 +90,1554 @@ var _ = Describe("Plugin", func() {
 	})
 
 	Describe("#Run", func() {
-		It("should connect to the app and send /tmp/watch file with contents from local file", func() {
-			mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password").Return(nil)
-			mockSession.EXPECT().Send("/tmp/watch", gomock.Any(), os.FileMode(0644), int64(9)).Return(nil).Do(func(path string, fileReadCloser io.ReadCloser, fileMode os.FileMode, length int64) {
-				data := make([]byte, 9)
-				fileReadCloser.Read(data)
-				Expect(string(data)).To(Equal("some-text"))
-			})
+		It("should connect to the app and send changed files until the watcher stops", func() {
+			events := make(chan Event, 4)
+			events <- Event{Op: Create, Path: "some-nested-dir", IsDir: true}
+			events <- Event{Op: Create, Path: "some-nested-dir/some-file"}
+			events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+			events <- Event{Op: Remove, Path: "some-nested-dir/some-other-file"}
+			close(events)
 
 			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
-			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint"}` + "\n"}, nil)
+			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
 			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
 
-			plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir/some-nested-dir/some-file"})
+			info, err := os.Stat("../fixtures/some-dir/some-nested-dir/some-file")
+			Expect(err).NotTo(HaveOccurred())
+			remoteFiles := map[string]remote.File{
+				"some-nested-dir/some-file": {Size: info.Size(), ModTime: info.ModTime()},
+				"some-staged-file":          {Size: 100, ModTime: time.Unix(1500000000, 0)},
+			}
+
+			gomock.InOrder(
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+				mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+				mockSession.EXPECT().List("/home/vcap/app", false).Return(remoteFiles, nil),
+				mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+				mockUI.EXPECT().Say("Kept %d files that only exist on instance %d. Use --delete to remove them.", 1, 0),
+				mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+				mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-nested-dir/some-other-file"}).Return(nil),
+				mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+				mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 1, 0),
+				mockSession.EXPECT().Close().Return(nil),
+			)
+
+			plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
+		})
+
+		Context("when the container differs from the local directory", func() {
+			var (
+				dir         string
+				remoteFiles map[string]remote.File
+			)
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Mkdir(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-same-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-resized-file"), []byte("some-longer-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-touched-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-ignored-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, ".cfignore"), []byte("some-ignored-file\n"), 0644)).To(Succeed())
+
+				modTime := time.Unix(1500000000, 0)
+				for _, name := range []string{"some-same-file", "some-resized-file"} {
+					Expect(os.Chtimes(filepath.Join(dir, name), modTime, modTime)).To(Succeed())
+				}
+
+				remoteFiles = map[string]remote.File{
+					"some-same-file":          {Size: 9, ModTime: modTime, Hash: "2142a57cb8587400fa7f4ee492f25cf07567f4a5"},
+					"some-resized-file":       {Size: 9, ModTime: modTime},
+					"some-touched-file":       {Size: 9, ModTime: modTime, Hash: "2142a57cb8587400fa7f4ee492f25cf07567f4a5"},
+					"some-removed-file":       {Size: 9, ModTime: modTime},
+					"some-dir":                {Size: 9, ModTime: modTime},
+					"some-ignored-file":       {Size: 9, ModTime: modTime},
+					".git/some-ignored-file":  {Size: 9, ModTime: modTime},
+					"some-dir/some-same-file": {Size: 9, ModTime: modTime},
+				}
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil)
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("should send files that differ in size or modification time before watching", func() {
+				events := make(chan Event)
+				close(events)
+
+				gomock.InOrder(
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(remoteFiles, nil),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-dir/some-new-file", "some-resized-file", "some-touched-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 1, 2, 0),
+					mockUI.EXPECT().Say("Kept %d files that only exist on instance %d. Use --delete to remove them.", 3, 0),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+			})
+
+			It("should compare checksums and remove files that only exist in the container when requested", func() {
+				events := make(chan Event)
+				close(events)
+
+				gomock.InOrder(
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockSession.EXPECT().List("/home/vcap/app", true).Return(remoteFiles, nil),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-dir", "some-dir/some-same-file", "some-removed-file"}).Return(nil),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-dir/some-new-file", "some-resized-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 1, 1, 3),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--checksum", "--delete"})
+			})
+
+			Context("when the remote files cannot be listed", func() {
+				It("should output a warning and keep watching", func() {
+					events := make(chan Event)
+					close(events)
+
+					gomock.InOrder(
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(nil, errors.New("some error")),
+						mockUI.EXPECT().Warn("Failed to list files on instance %d: %s", 0, errors.New("some error")),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+				})
+			})
+
+			Context("when the container reports a fatal error", func() {
+				It("should output a failure message", func() {
+					events := make(chan Event)
+					fatal := &scp.RemoteError{Message: "scp: some-file: No space left on device"}
+
+					gomock.InOrder(
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(remoteFiles, nil),
+						mockSession.EXPECT().SendFiles("/home/vcap/app", dir, gomock.Any()).Return(fatal),
+						mockUI.EXPECT().Failed("%s", fatal),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+				})
+			})
+		})
+
+		Context("when a burst of events arrives", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-other-file"), []byte("some-text"), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("should send the latest state of each path in one transfer per quiet period", func() {
+				events := make(chan Event)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-new-file", "some-removed-file"}).Return(nil),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file", "some-other-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 2, 2, 0),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					events <- Event{Op: Write, Path: "some-file"}
+					events <- Event{Op: Create, Path: "some-other-file"}
+					events <- Event{Op: Write, Path: "some-file"}
+					events <- Event{Op: Create, Path: "some-new-file"}
+					events <- Event{Op: Remove, Path: "some-new-file"}
+					events <- Event{Op: Remove, Path: "some-removed-file"}
+					events <- Event{Op: Write, Path: "some-vanished-file"}
+					quiet <- time.Now()
+					events <- Event{Op: Write, Path: "some-file"}
+					quiet <- time.Now()
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--skip-initial-sync"})
+			})
+		})
+
+		Context("when the connection is lost", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-other-file"), []byte("some-text"), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("should reconnect with a fresh SSH code, backing off, and replay the queued changes", func() {
+				events := make(chan Event)
+				retry := make(chan time.Time)
+				var delays []time.Duration
+				plugin.After = func(d time.Duration) <-chan time.Time {
+					if d == 200*time.Millisecond {
+						return quiet
+					}
+					delays = append(delays, d)
+					return retry
+				}
+				reconnectedSession := mocks.NewMockSession(mockCtrl)
+				sessions := []Session{mockSession, reconnectedSession}
+				plugin.NewSession = func(SessionConfig) Session {
+					session := sessions[0]
+					sessions = sessions[1:]
+					return session
+				}
+				lost := &scp.DisconnectedError{Err: errors.New("EOF")}
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				gomock.InOrder(
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil),
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return(nil, errors.New("some error")),
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-new-password\n"}, nil),
+				)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file"}).Return(lost),
+					mockUI.EXPECT().Warn("Lost connection to instance %d: %s", 0, lost),
+					mockSession.EXPECT().Close().Return(nil),
+					mockUI.EXPECT().Say("Reconnecting in %s...", time.Second),
+					mockUI.EXPECT().Warn("Instance %d: Failed to retrieve SSH code: %s", 0, errors.New("some error")),
+					mockUI.EXPECT().Say("Reconnecting in %s...", 2*time.Second),
+					reconnectedSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-new-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Reconnected to instance %d", 0),
+					reconnectedSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file", "some-other-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 2, 0, 0),
+					reconnectedSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					events <- Event{Op: Write, Path: "some-file"}
+					quiet <- time.Now()
+					events <- Event{Op: Write, Path: "some-other-file"}
+					quiet <- time.Now()
+					retry <- time.Now()
+					retry <- time.Now()
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--skip-initial-sync"})
+				Expect(delays).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+			})
+
+			Context("during the initial sync", func() {
+				It("should sync again once reconnected", func() {
+					events := make(chan Event)
+					retry := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						Expect(d).To(Equal(time.Second))
+						return retry
+					}
+					reconnectedSession := mocks.NewMockSession(mockCtrl)
+					sessions := []Session{mockSession, reconnectedSession}
+					plugin.NewSession = func(SessionConfig) Session {
+						session := sessions[0]
+						sessions = sessions[1:]
+						return session
+					}
+					lost := &scp.DisconnectedError{Err: errors.New("EOF")}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(nil, lost),
+						mockUI.EXPECT().Warn("Lost connection to instance %d: %s", 0, lost),
+						mockSession.EXPECT().Close().Return(nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir),
+						mockUI.EXPECT().Say("Reconnecting in %s...", time.Second),
+						reconnectedSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockUI.EXPECT().Say("Reconnected to instance %d", 0),
+						reconnectedSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+						reconnectedSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file", "some-other-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 2, 0, 0),
+						reconnectedSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						retry <- time.Now()
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+				})
+			})
+
+			Context("while the session is idle", func() {
+				It("should reconnect before the next change", func() {
+					events := make(chan Event)
+					retry := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						Expect(d).To(Equal(time.Second))
+						return retry
+					}
+					monitored := &monitoredSession{MockSession: mockSession, lost: make(chan struct{})}
+					reconnectedSession := mocks.NewMockSession(mockCtrl)
+					sessions := []Session{monitored, reconnectedSession}
+					plugin.NewSession = func(SessionConfig) Session {
+						session := sessions[0]
+						sessions = sessions[1:]
+						return session
+					}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir),
+						mockUI.EXPECT().Warn("Lost connection to instance %d", 0),
+						mockSession.EXPECT().Close().Return(nil),
+						mockUI.EXPECT().Say("Reconnecting in %s...", time.Second),
+						reconnectedSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockUI.EXPECT().Say("Reconnected to instance %d", 0),
+						reconnectedSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						close(monitored.lost)
+						retry <- time.Now()
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--skip-initial-sync"})
+				})
+
+				Context("when the initial sync is not skipped", func() {
+					It("should sync again once reconnected", func() {
+						events := make(chan Event)
+						retry := make(chan time.Time)
+						plugin.After = func(d time.Duration) <-chan time.Time {
+							Expect(d).To(Equal(time.Second))
+							return retry
+						}
+						monitored := &monitoredSession{MockSession: mockSession, lost: make(chan struct{})}
+						reconnectedSession := mocks.NewMockSession(mockCtrl)
+						sessions := []Session{monitored, reconnectedSession}
+						plugin.NewSession = func(SessionConfig) Session {
+							session := sessions[0]
+							sessions = sessions[1:]
+							return session
+						}
+
+						mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+						mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+						mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+						mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+						gomock.InOrder(
+							mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+							mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+							mockSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+							mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file", "some-other-file"}).Return(nil),
+							mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 2, 0, 0),
+							mockUI.EXPECT().Say("Watching %s for changes...", dir),
+							mockUI.EXPECT().Warn("Lost connection to instance %d", 0),
+							mockSession.EXPECT().Close().Return(nil),
+							mockUI.EXPECT().Say("Reconnecting in %s...", time.Second),
+							reconnectedSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+							mockUI.EXPECT().Say("Reconnected to instance %d", 0),
+							reconnectedSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+							reconnectedSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-file", "some-other-file"}).Return(nil),
+							mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 2, 0, 0),
+							reconnectedSession.EXPECT().Close().Return(nil),
+						)
+
+						go func() {
+							close(monitored.lost)
+							retry <- time.Now()
+							close(events)
+						}()
+
+						plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+					})
+				})
+			})
+		})
+
+		Context("when a build command is provided", func() {
+			var stdout, stderr *gbytes.Buffer
+
+			BeforeEach(func() {
+				stdout = gbytes.NewBuffer()
+				stderr = gbytes.NewBuffer()
+				plugin.Stdout = stdout
+				plugin.Stderr = stderr
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+			})
+
+			It("should build for Linux on each change and send only the artifacts", func() {
+				build := `mkdir -p "$CF_WATCH_BUILD_DIR/bin" && echo "$GOOS/$GOARCH" | tee "$CF_WATCH_BUILD_DIR/bin/some-app"`
+				events := make(chan Event, 1)
+				events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+
+				sent := func(_, localDir string, _ []string) {
+					Expect(ioutil.ReadFile(filepath.Join(localDir, ".cf-watch-build", "bin", "some-app"))).To(Equal([]byte("linux/amd64\n")))
+				}
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Building with %s", build),
+					mockUI.EXPECT().Say("Built %s", "bin/some-app"),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", gomock.Any(), []string{".cf-watch-build/bin/some-app"}).Do(sent).Return(nil),
+					mockSession.EXPECT().Rename("/home/vcap/app", ".cf-watch-build/bin/some-app", "bin/some-app").Return(nil),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{".cf-watch-build"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockUI.EXPECT().Say("Building with %s", build),
+					mockUI.EXPECT().Say("Built %s", "bin/some-app"),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", gomock.Any(), []string{".cf-watch-build/bin/some-app"}).Do(sent).Return(nil),
+					mockSession.EXPECT().Rename("/home/vcap/app", ".cf-watch-build/bin/some-app", "bin/some-app").Return(nil),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{".cf-watch-build"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					quiet <- time.Now()
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--build", build})
+				Expect(stdout).To(gbytes.Say("linux/amd64"))
+			})
+
+			Context("when the build fails", func() {
+				It("should show the failure and send nothing", func() {
+					events := make(chan Event, 1)
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					close(events)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockUI.EXPECT().Say("Building with %s", "echo some-build-error >&2; exit 2"),
+						mockUI.EXPECT().Warn("Build failed: %s", gomock.Any()).Do(func(_ string, err error) {
+							Expect(err).To(MatchError("exit status 2"))
+						}),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--build", "echo some-build-error >&2; exit 2"})
+					Expect(stderr).To(gbytes.Say("some-build-error"))
+				})
+			})
+		})
+
+		Context("when restarting the app is requested", func() {
+			var stdout, stderr *gbytes.Buffer
+
+			BeforeEach(func() {
+				stdout = gbytes.NewBuffer()
+				stderr = gbytes.NewBuffer()
+				plugin.Stdout = stdout
+				plugin.Stderr = stderr
+			})
+
+			install := func(stagingInfo string) *gomock.Call {
+				return mockSession.EXPECT().Run("/home/vcap/app", gomock.Any(), gomock.Any(), gomock.Any()).Do(func(_, command string, stdout, _ io.Writer) {
+					Expect(command).To(HavePrefix("mkdir -p /home/vcap/.cf-watch && cat >/home/vcap/.cf-watch/supervise <<'CF_WATCH_EOF'"))
+					Expect(command).To(ContainSubstring("cat /home/vcap/staging_info.yml"))
+					fmt.Fprint(stdout, stagingInfo)
+				})
+			}
+
+			It("should install the supervisor, start the app after the initial sync and restart it after each batch", func() {
+				dir, err := ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(dir)
+
+				events := make(chan Event, 1)
+				events <- Event{Op: Remove, Path: "some-file"}
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1, "command": "sleep infinity"}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				supervise := `/home/vcap/.cf-watch/supervise './bin/app --name '\''some app'\'''`
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					install(`{"detected_buildpack":"go","start_command":"./bin/app --name 'some app'"}`).Return(nil),
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+					mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+					mockUI.EXPECT().Say("Restarting app on instance %d", 0),
+					mockSession.EXPECT().Run("/home/vcap/app", supervise, stdout, stderr).Return(nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 1, 0),
+					mockUI.EXPECT().Say("Restarting app on instance %d", 0),
+					mockSession.EXPECT().Run("/home/vcap/app", supervise, stdout, stderr).Return(errors.New("some error")),
+					mockUI.EXPECT().Warn("Failed to restart app on instance %d: %s", 0, errors.New("some error")),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--restart"})
+			})
+
+			DescribeTable("should find the start command and start the app when the initial sync is skipped",
+				func(stagingInfo, appJSON, command string) {
+					events := make(chan Event)
+					close(events)
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{appJSON + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						install(stagingInfo).Return(nil),
+						mockUI.EXPECT().Say("Restarting app on instance %d", 0),
+						mockSession.EXPECT().Run("/home/vcap/app", "/home/vcap/.cf-watch/supervise "+command, stdout, stderr).Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--restart"})
+				},
+				Entry("from staging_info.yml as JSON", `{"start_command":"./bin/app"}`, `{"entity": {"instances": 1, "command": "sleep infinity"}}`, "./bin/app"),
+				Entry("from staging_info.yml as YAML", "---\nstart_command: ./bin/app\n", `{"entity": {"instances": 1}}`, "./bin/app"),
+				Entry("from the app command", "", `{"entity": {"instances": 1, "command": "./bin/web", "detected_start_command": "./bin/detected"}}`, "./bin/web"),
+				Entry("from the detected start command", "", `{"entity": {"instances": 1, "detected_start_command": "./bin/detected"}}`, "./bin/detected"),
+			)
+
+			Context("when the first build fails", func() {
+				It("should start the app as it was staged", func() {
+					events := make(chan Event)
+					close(events)
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						install(`{"start_command":"./bin/app"}`).Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Building with %s", "exit 2"),
+						mockUI.EXPECT().Warn("Build failed: %s", gomock.Any()),
+						mockUI.EXPECT().Say("Restarting app on instance %d", 0),
+						mockSession.EXPECT().Run("/home/vcap/app", "/home/vcap/.cf-watch/supervise ./bin/app", stdout, stderr).Return(nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--build", "exit 2", "--restart"})
+				})
+			})
+
+			Context("when no start command is found", func() {
+				It("should output a failure message", func() {
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						install("").Return(nil),
+						mockSession.EXPECT().Close().Return(nil),
+						mockUI.EXPECT().Failed("%s", errors.New("Failed to install supervisor: no start command found in staging_info.yml or the app")),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--restart"})
+				})
+			})
+		})
+
+		Context("when paths are renamed and removed", func() {
+			It("should rename and remove them in the container", func() {
+				events := make(chan Event, 8)
+				events <- Event{Op: Remove, Path: "some-old-dir/some-file"}
+				events <- Event{Op: Remove, Path: "some-old-dir", IsDir: true}
+				events <- Event{Op: Write, Path: "some-dir/some-file"}
+				events <- Event{Op: Rename, Path: "some-renamed-dir", OldPath: "some-dir", IsDir: true}
+				events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+				events <- Event{Op: Rename, Path: "some-nested-dir/some-renamed-file", OldPath: "some-nested-dir/some-file"}
+				events <- Event{Op: Write, Path: "some-nested-dir/some-renamed-file"}
+				events <- Event{Op: Rename, Path: "some-other-renamed-file", OldPath: "some-other-file"}
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Rename("/home/vcap/app", "some-dir", "some-renamed-dir").Return(nil),
+					mockSession.EXPECT().Rename("/home/vcap/app", "some-other-file", "some-other-renamed-file").Return(errors.New("some error")),
+					mockUI.EXPECT().Warn("Failed to rename %s to %s on instance %d: %s", "some-other-file", "some-other-renamed-file", 0, errors.New("some error")),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-nested-dir/some-file", "some-old-dir"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 2, 1),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+
+			Context("when an on-sync command is provided", func() {
+				var stdout, stderr *gbytes.Buffer
+
+				BeforeEach(func() {
+					stdout = gbytes.NewBuffer()
+					stderr = gbytes.NewBuffer()
+					plugin.Stdout = stdout
+					plugin.Stderr = stderr
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+				})
+
+				It("should run the command after each batch and stream its output", func() {
+					events := make(chan Event, 1)
+					events <- Event{Op: Remove, Path: "some-file"}
+					close(events)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 1, 0),
+						mockUI.EXPECT().Say("Running %s on instance %d", "kill -HUP 1", 0),
+						mockSession.EXPECT().Run("/home/vcap/app", "kill -HUP 1", stdout, stderr).Do(func(_, _ string, stdout, stderr io.Writer) {
+							fmt.Fprint(stdout, "some-output")
+							fmt.Fprint(stderr, "some-error-output")
+						}).Return(nil),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--on-sync", "kill -HUP 1"})
+					Expect(stdout).To(gbytes.Say("some-output"))
+					Expect(stderr).To(gbytes.Say("some-error-output"))
+				})
+
+				Context("when the command fails", func() {
+					It("should output a warning", func() {
+						events := make(chan Event, 1)
+						events <- Event{Op: Remove, Path: "some-file"}
+						close(events)
+
+						gomock.InOrder(
+							mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+							mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+							mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+							mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-file"}).Return(nil),
+							mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 1, 0),
+							mockUI.EXPECT().Say("Running %s on instance %d", "go build", 0),
+							mockSession.EXPECT().Run("/home/vcap/app", "go build", stdout, stderr).Return(errors.New("Process exited with status 2")),
+							mockUI.EXPECT().Warn("Command %s failed on instance %d: %s", "go build", 0, errors.New("Process exited with status 2")),
+							mockSession.EXPECT().Close().Return(nil),
+						)
+
+						plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--on-sync", "go build"})
+					})
+				})
+
+				Context("when the batch is not fully synced", func() {
+					It("should not run the command", func() {
+						events := make(chan Event, 1)
+						events <- Event{Op: Remove, Path: "some-file"}
+						close(events)
+
+						gomock.InOrder(
+							mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+							mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+							mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+							mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-file"}).Return(errors.New("some error")),
+							mockUI.EXPECT().Warn("Failed to remove %s from instance %d: %s", "some-file", 0, errors.New("some error")),
+							mockSession.EXPECT().Close().Return(nil),
+						)
+
+						plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--on-sync", "kill -HUP 1"})
+					})
+				})
+			})
+
+			Context("when the container reports a fatal error", func() {
+				It("should output a failure message", func() {
+					events := make(chan Event, 1)
+					events <- Event{Op: Remove, Path: "some-file"}
+					close(events)
+
+					fatal := &scp.RemoteError{Message: "rm: some-file: Read-only file system"}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockSession.EXPECT().Remove("/home/vcap/app", []string{"some-file"}).Return(fatal),
+						mockUI.EXPECT().Failed("%s", fatal),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+				})
+			})
+		})
+
+		Context("when interrupted", func() {
+			It("should stop watching and close the session", func() {
+				events := make(chan Event)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				var stop <-chan struct{}
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil).Do(func(_ string, _ *Filter, stopChan <-chan struct{}) {
+						stop = stopChan
+					}),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir").Do(func(string, string) {
+						interrupt <- os.Interrupt
+					}),
+					mockUI.EXPECT().Say("Stopped watching %s.", "../fixtures/some-dir"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+				Expect(stop).To(BeClosed())
+			})
+		})
+
+		Context("when flags follow the positional arguments", func() {
+			It("should parse them", func() {
+				events := make(chan Event)
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "-i", "1", "../fixtures/some-dir", "--destination", "/tmp/some-destination", "--skip-initial-sync"})
+			})
+		})
+
+		Context("when a transport and delta mode are provided", func() {
+			It("should create sessions with that configuration", func() {
+				events := make(chan Event)
+				close(events)
+
+				var configs []SessionConfig
+				plugin.NewSession = func(config SessionConfig) Session {
+					configs = append(configs, config)
+					return mockSession
+				}
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--transport", "tar", "--delta", "--skip-initial-sync"})
+				Expect(configs).To(Equal([]SessionConfig{{Transport: "tar", Delta: true, KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}}))
+			})
+		})
+
+		Context("when the local directory is omitted", func() {
+			It("should watch the current directory", func() {
+				events := make(chan Event)
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch(".", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "."),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "--skip-initial-sync"})
+			})
+		})
+
+		Context("when logs are shown", func() {
+			var (
+				mockLogStreamer *mocks.MockLogStreamer
+				logTime         time.Time
+			)
+
+			BeforeEach(func() {
+				mockLogStreamer = mocks.NewMockLogStreamer(mockCtrl)
+				plugin.Logs = mockLogStreamer
+				logTime = time.Date(2017, 1, 2, 3, 4, 5, 0, time.Local)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+				mockCLI.EXPECT().DopplerEndpoint().Return("wss://some-doppler-endpoint", nil).AnyTimes()
+				mockCLI.EXPECT().AccessToken().Return("bearer some-token", nil).AnyTimes()
+				mockCLI.EXPECT().IsSSLDisabled().Return(true, nil).AnyTimes()
+			})
+
+			It("should show the app's logs along with sync events", func() {
+				events := make(chan Event)
+				logs := make(chan remote.LogMessage)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return((<-chan remote.LogMessage)(logs), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockUI.EXPECT().Say("   %s [%s/%s] %s %s", "03:04:05", "APP/PROC/WEB", "0", "OUT", "some-output"),
+					mockUI.EXPECT().Say("   %s [%s/%s] %s %s", "03:04:05", "RTR", "1", "ERR", "some-error"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					logs <- remote.LogMessage{Time: logTime, Source: "APP/PROC/WEB", Instance: "0", Message: "some-output\n"}
+					logs <- remote.LogMessage{Time: logTime, Source: "RTR", Instance: "1", Stderr: true, Message: "some-error"}
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--logs"})
+			})
+
+			DescribeTable("should only show logs from the chosen source",
+				func(source, shown string) {
+					events := make(chan Event)
+					logs := make(chan remote.LogMessage)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return((<-chan remote.LogMessage)(logs), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockUI.EXPECT().Say("   %s [%s/%s] %s %s", "03:04:05", shown, "0", "OUT", "some-output"),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						logs <- remote.LogMessage{Time: logTime, Source: "APP/PROC/WEB", Instance: "0", Message: "some-output"}
+						logs <- remote.LogMessage{Time: logTime, Source: "STG", Instance: "0", Message: "some-output"}
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--logs", "--log-source", source})
+				},
+				Entry("for the app", "app", "APP/PROC/WEB"),
+				Entry("for the platform", "platform", "STG"),
+			)
+
+			Context("when the log stream ends", func() {
+				It("should resubscribe after a delay, retrying on failure", func() {
+					events := make(chan Event)
+					logs := make(chan remote.LogMessage)
+					newLogs := make(chan remote.LogMessage)
+					retry := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						Expect(d).To(Equal(time.Second))
+						return retry
+					}
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return((<-chan remote.LogMessage)(logs), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockUI.EXPECT().Warn("App log stream ended. Reconnecting in %s...", time.Second),
+						mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return(nil, errors.New("some error")),
+						mockUI.EXPECT().Warn("Failed to stream app logs: %s. Retrying in %s...", errors.New("some error"), time.Second),
+						mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return((<-chan remote.LogMessage)(newLogs), nil),
+						mockUI.EXPECT().Say("   %s [%s/%s] %s %s", "03:04:05", "APP/PROC/WEB", "0", "OUT", "some-output"),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						close(logs)
+						retry <- time.Now()
+						retry <- time.Now()
+						newLogs <- remote.LogMessage{Time: logTime, Source: "APP/PROC/WEB", Instance: "0", Message: "some-output"}
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--logs"})
+				})
+			})
+
+			Context("when the log stream cannot be opened", func() {
+				It("should output a failure message", func() {
+					events := make(chan Event)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockLogStreamer.EXPECT().Stream("wss://some-doppler-endpoint", "bearer some-token", "some-guid", true, gomock.Any()).Return(nil, errors.New("some error")),
+						mockUI.EXPECT().Failed("Failed to stream app logs: %s", errors.New("some error")),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--logs"})
+				})
+			})
+		})
+
+		Context("when ports are forwarded", func() {
+			var localAddress string
+
+			BeforeEach(func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				localAddress = listener.Addr().String()
+				Expect(listener.Close()).To(Succeed())
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+			})
+
+			It("should forward connections to the local port through the session", func() {
+				events := make(chan Event)
+				remote, container := net.Pipe()
+				replies := make(chan string, 1)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Forwarding %s to %s on instance %d", localAddress, "localhost:5005", 1),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir").Do(func(string, string) {
+						go func() {
+							defer GinkgoRecover()
+							conn, err := net.Dial("tcp", localAddress)
+							Expect(err).NotTo(HaveOccurred())
+							defer conn.Close()
+							fmt.Fprint(conn, "some-request")
+							reply, err := ioutil.ReadAll(conn)
+							Expect(err).NotTo(HaveOccurred())
+							replies <- string(reply)
+							close(events)
+						}()
+					}),
+					mockSession.EXPECT().Dial("localhost:5005").Return(remote, nil),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					defer GinkgoRecover()
+					request := make([]byte, len("some-request"))
+					_, err := io.ReadFull(container, request)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(request)).To(Equal("some-request"))
+					fmt.Fprint(container, "some-response")
+					container.Close()
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "-i", "1", "-L", localAddress + ":localhost:5005"})
+				Expect(replies).To(Receive(Equal("some-response")))
+			})
+
+			Context("when the remote address is slow to answer", func() {
+				It("should keep syncing changes while it is dialed", func() {
+					events := make(chan Event)
+					remote, container := net.Pipe()
+					dialing := make(chan struct{})
+					synced := make(chan struct{})
+					replies := make(chan string, 1)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Forwarding %s to %s on instance %d", localAddress, "localhost:5005", 0),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir").Do(func(string, string) {
+							go func() {
+								defer GinkgoRecover()
+								conn, err := net.Dial("tcp", localAddress)
+								Expect(err).NotTo(HaveOccurred())
+								defer conn.Close()
+								<-dialing
+								events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+								quiet <- time.Now()
+								reply, err := ioutil.ReadAll(conn)
+								Expect(err).NotTo(HaveOccurred())
+								replies <- string(reply)
+								close(events)
+							}()
+						}),
+					)
+					mockSession.EXPECT().Dial("localhost:5005").Do(func(string) {
+						close(dialing)
+						<-synced
+					}).Return(remote, nil)
+					gomock.InOrder(
+						mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0).Do(func(string, int, int, int, int) {
+							close(synced)
+						}),
+					)
+					mockSession.EXPECT().Close().Return(nil)
+
+					go func() {
+						defer GinkgoRecover()
+						fmt.Fprint(container, "some-response")
+						container.Close()
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "-L", localAddress + ":localhost:5005"})
+					Expect(replies).To(Receive(Equal("some-response")))
+				})
+			})
+
+			Context("when the remote address cannot be reached", func() {
+				It("should output a warning and close the connection", func() {
+					events := make(chan Event)
+					closed := make(chan struct{})
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Forwarding %s to %s on instance %d", localAddress, "localhost:5005", 0),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir").Do(func(string, string) {
+							go func() {
+								defer GinkgoRecover()
+								conn, err := net.Dial("tcp", localAddress)
+								Expect(err).NotTo(HaveOccurred())
+								defer conn.Close()
+								Expect(ioutil.ReadAll(conn)).To(BeEmpty())
+								close(closed)
+								close(events)
+							}()
+						}),
+						mockSession.EXPECT().Dial("localhost:5005").Return(nil, errors.New("some error")),
+						mockUI.EXPECT().Warn("Failed to forward %s to %s on instance %d: %s", localAddress, "localhost:5005", 0, errors.New("some error")),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "-L", localAddress + ":localhost:5005"})
+					Expect(closed).To(BeClosed())
+				})
+			})
+
+			Context("when the local port is in use", func() {
+				It("should output a failure message", func() {
+					listener, err := net.Listen("tcp", localAddress)
+					Expect(err).NotTo(HaveOccurred())
+					defer listener.Close()
+					events := make(chan Event)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Failed("Failed to forward local port: %s", gomock.Any()).Do(func(_ string, err error) {
+							Expect(err).To(MatchError(ContainSubstring("address already in use")))
+						}),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "-L", localAddress + ":localhost:5005"})
+				})
+			})
+		})
+
+		Context("when LiveReload is enabled", func() {
+			var mockReloader *mocks.MockReloader
+
+			BeforeEach(func() {
+				mockReloader = mocks.NewMockReloader(mockCtrl)
+				plugin.NewReloader = func(address string) (Reloader, error) {
+					Expect(address).To(Equal("localhost:35729"))
+					return mockReloader, nil
+				}
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+			})
+
+			It("should reload browsers after each synced batch", func() {
+				events := make(chan Event)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("LiveReload server listening on %s", "localhost:35729"),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Rename("/home/vcap/app", "css/some-old-style.css", "css/some-style.css").Return(nil),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"css/some-other-style.css"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 1, 1),
+					mockReloader.EXPECT().Reload([]string{"css/some-other-style.css", "css/some-style.css"}),
+					mockSession.EXPECT().Remove("/home/vcap/app", []string{"index.html"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 0, 1, 0),
+					mockReloader.EXPECT().Reload([]string{"index.html"}),
+					mockReloader.EXPECT().Close().Return(nil),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					events <- Event{Op: Rename, OldPath: "css/some-old-style.css", Path: "css/some-style.css"}
+					events <- Event{Op: Remove, Path: "css/some-other-style.css"}
+					quiet <- time.Now()
+					events <- Event{Op: Remove, Path: "index.html"}
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--livereload"})
+			})
+
+			Context("when the batch is not fully synced", func() {
+				It("should not reload browsers", func() {
+					events := make(chan Event, 1)
+					events <- Event{Op: Remove, Path: "index.html"}
+					close(events)
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("LiveReload server listening on %s", "localhost:35729"),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+						mockSession.EXPECT().Remove("/home/vcap/app", []string{"index.html"}).Return(errors.New("some error")),
+						mockUI.EXPECT().Warn("Failed to remove %s from instance %d: %s", "index.html", 0, errors.New("some error")),
+						mockReloader.EXPECT().Close().Return(nil),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--livereload"})
+				})
+			})
+
+			Context("when the server cannot be started", func() {
+				It("should output a failure message", func() {
+					events := make(chan Event)
+					plugin.NewReloader = func(string) (Reloader, error) {
+						return nil, errors.New("some error")
+					}
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Failed("Failed to start LiveReload server: %s", errors.New("some error")),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync", "--livereload"})
+				})
+			})
+		})
+
+		Context("with two-way sync", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				for _, name := range []string{"some-file", "some-conflict-file", "some-old-file"} {
+					Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte("some-text"), 0644)).To(Succeed())
+					Expect(os.Chtimes(filepath.Join(dir, name), time.Unix(1500000000, 0), time.Unix(1500000000, 0))).To(Succeed())
+				}
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("should pull changes made in the container, send local changes, and report conflicts", func() {
+				events := make(chan Event)
+				poll := make(chan time.Time)
+				plugin.After = func(d time.Duration) <-chan time.Time {
+					if d == 5*time.Second {
+						return poll
+					}
+					Expect(d).To(Equal(200 * time.Millisecond))
+					return quiet
+				}
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				synced := map[string]remote.File{
+					"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					"some-conflict-file": {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+				}
+				changed := map[string]remote.File{
+					"some-file":          {Size: 17, ModTime: time.Unix(1600000000, 0)},
+					"some-conflict-file": {Size: 15, ModTime: time.Unix(1600000000, 0)},
+					"some-new-file":      {Size: 4, ModTime: time.Unix(1600000000, 0)},
+				}
+				sent := map[string]remote.File{
+					"some-file":          {Size: 17, ModTime: time.Unix(1600000000, 0)},
+					"some-conflict-file": {Size: 15, ModTime: time.Unix(1600000000, 0)},
+					"some-new-file":      {Size: 4, ModTime: time.Unix(1600000000, 0)},
+					"some-local-file":    {Size: 10, ModTime: time.Unix(1700000000, 0)},
+				}
+				receive := func(contents string) func(string, string) {
+					return func(_, localPath string) {
+						Expect(ioutil.WriteFile(localPath, []byte(contents), 0644)).To(Succeed())
+						Expect(os.Chtimes(localPath, time.Unix(1600000000, 0), time.Unix(1600000000, 0))).To(Succeed())
+					}
+				}
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+					mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir).Do(func(string, string) {
+						Expect(ioutil.WriteFile(filepath.Join(dir, "some-conflict-file"), []byte("some-local-text"), 0644)).To(Succeed())
+					}),
+
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(changed, nil),
+					mockUI.EXPECT().Warn("Conflict: %s changed both locally and on instance %d. Neither copy was overwritten.", "some-conflict-file", 0),
+					mockSession.EXPECT().Receive("/home/vcap/app/some-file", filepath.Join(dir, "some-file")).Do(receive("some-new-contents")).Return(nil),
+					mockSession.EXPECT().Receive("/home/vcap/app/some-new-file", filepath.Join(dir, "some-new-file")).Do(receive("text")).Return(nil),
+					mockUI.EXPECT().Say("Synced changes with instance %d: %d sent, %d removed, %d pulled, %d removed locally", 0, 0, 0, 2, 1),
+
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(changed, nil),
+
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(changed, nil),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-local-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes with instance %d: %d sent, %d removed, %d pulled, %d removed locally", 0, 1, 0, 0, 0),
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(sent, nil),
+
+					mockSession.EXPECT().List("/home/vcap/app", false).Return(sent, nil),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				go func() {
+					poll <- time.Now()
+					events <- Event{Op: Write, Path: "some-file"}
+					quiet <- time.Now()
+					events <- Event{Op: Create, Path: "some-local-file"}
+					Expect(ioutil.WriteFile(filepath.Join(dir, "some-local-file"), []byte("some-local"), 0644)).To(Succeed())
+					quiet <- time.Now()
+					poll <- time.Now()
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--two-way", "--poll-interval", "5s"})
+
+				Expect(ioutil.ReadFile(filepath.Join(dir, "some-file"))).To(Equal([]byte("some-new-contents")))
+				Expect(ioutil.ReadFile(filepath.Join(dir, "some-new-file"))).To(Equal([]byte("text")))
+				Expect(ioutil.ReadFile(filepath.Join(dir, "some-conflict-file"))).To(Equal([]byte("some-local-text")))
+				Expect(filepath.Join(dir, "some-old-file")).NotTo(BeAnExistingFile())
+			})
+
+			Context("after a conflict", func() {
+				It("should copy the file once it changes again on one side", func() {
+					events := make(chan Event)
+					poll := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						Expect(d).To(Equal(5 * time.Second))
+						return poll
+					}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					synced := map[string]remote.File{
+						"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-conflict-file": {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					}
+					conflicting := map[string]remote.File{
+						"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-conflict-file": {Size: 15, ModTime: time.Unix(1600000000, 0)},
+						"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					}
+					sent := map[string]remote.File{
+						"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-conflict-file": {Size: 21, ModTime: time.Unix(1700000000, 0)},
+						"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					}
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir).Do(func(string, string) {
+							Expect(ioutil.WriteFile(filepath.Join(dir, "some-conflict-file"), []byte("some-local-text"), 0644)).To(Succeed())
+						}),
+
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(conflicting, nil),
+						mockUI.EXPECT().Warn("Conflict: %s changed both locally and on instance %d. Neither copy was overwritten.", "some-conflict-file", 0).Do(func(string, string, int) {
+							Expect(ioutil.WriteFile(filepath.Join(dir, "some-conflict-file"), []byte("some-newer-local-text"), 0644)).To(Succeed())
+							Expect(os.Chtimes(filepath.Join(dir, "some-conflict-file"), time.Unix(1700000000, 0), time.Unix(1700000000, 0))).To(Succeed())
+						}),
+
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(conflicting, nil),
+						mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-conflict-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced changes with instance %d: %d sent, %d removed, %d pulled, %d removed locally", 0, 1, 0, 0, 0),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(sent, nil),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						poll <- time.Now()
+						poll <- time.Now()
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--two-way", "--poll-interval", "5s"})
+				})
+			})
+
+			Context("when the instance reconnects after its container was restarted", func() {
+				It("should sync the local files again instead of removing them", func() {
+					events := make(chan Event)
+					poll := make(chan time.Time)
+					retry := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						if d == 5*time.Second {
+							return poll
+						}
+						Expect(d).To(Equal(time.Second))
+						return retry
+					}
+					monitored := &monitoredSession{MockSession: mockSession, lost: make(chan struct{})}
+					reconnectedSession := mocks.NewMockSession(mockCtrl)
+					sessions := []Session{monitored, reconnectedSession}
+					plugin.NewSession = func(SessionConfig) Session {
+						session := sessions[0]
+						sessions = sessions[1:]
+						return session
+					}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+					synced := map[string]remote.File{
+						"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-conflict-file": {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					}
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir),
+						mockUI.EXPECT().Warn("Lost connection to instance %d", 0),
+						mockSession.EXPECT().Close().Return(nil),
+						mockUI.EXPECT().Say("Reconnecting in %s...", time.Second),
+						reconnectedSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockUI.EXPECT().Say("Reconnected to instance %d", 0),
+
+						reconnectedSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+						reconnectedSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-conflict-file", "some-file", "some-old-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 3, 0, 0),
+						reconnectedSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						reconnectedSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						reconnectedSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						close(monitored.lost)
+						retry <- time.Now()
+						poll <- time.Now()
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--two-way", "--poll-interval", "5s"})
+
+					for _, name := range []string{"some-file", "some-conflict-file", "some-old-file"} {
+						Expect(ioutil.ReadFile(filepath.Join(dir, name))).To(Equal([]byte("some-text")))
+					}
+				})
+			})
+
+			Context("when the remote directory is found empty", func() {
+				It("should keep the local files and sync them again", func() {
+					events := make(chan Event)
+					poll := make(chan time.Time)
+					plugin.After = func(d time.Duration) <-chan time.Time {
+						Expect(d).To(Equal(5 * time.Second))
+						return poll
+					}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+					synced := map[string]remote.File{
+						"some-file":          {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-conflict-file": {Size: 9, ModTime: time.Unix(1500000000, 0)},
+						"some-old-file":      {Size: 9, ModTime: time.Unix(1500000000, 0)},
+					}
+
+					gomock.InOrder(
+						mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 0, 0, 0),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", dir),
+
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+						mockUI.EXPECT().Warn("Found no files in %s on instance %d. Local files were kept and will be synced again.", "/home/vcap/app", 0),
+
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(map[string]remote.File{}, nil),
+						mockSession.EXPECT().SendFiles("/home/vcap/app", dir, []string{"some-conflict-file", "some-file", "some-old-file"}).Return(nil),
+						mockUI.EXPECT().Say("Synced instance %d: %d added, %d updated, %d removed", 0, 3, 0, 0),
+						mockSession.EXPECT().List("/home/vcap/app", false).Return(synced, nil),
+						mockSession.EXPECT().Close().Return(nil),
+					)
+
+					go func() {
+						poll <- time.Now()
+						poll <- time.Now()
+						close(events)
+					}()
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--two-way", "--poll-interval", "5s"})
+
+					for _, name := range []string{"some-file", "some-conflict-file", "some-old-file"} {
+						Expect(ioutil.ReadFile(filepath.Join(dir, name))).To(Equal([]byte("some-text")))
+					}
+				})
+			})
+		})
+
+		Context("when the plugin is uninstalled", func() {
+			It("should do nothing", func() {
+				plugin.Run(mockCLI, []string{"CLI-MESSAGE-UNINSTALL"})
+			})
+		})
+
+		Context("when the arguments are invalid", func() {
+			DescribeTable("should output a failure message with usage",
+				func(args []string, message string) {
+					mockUI.EXPECT().Failed("Incorrect usage: %s\n\nUSAGE:\n   %s", gomock.Any(), "cf watch APP_NAME [LOCAL_DIR] [--destination REMOTE_DIR] [-i INDEX | --all-instances] [--debounce DURATION] [--skip-initial-sync | [--checksum] [--delete]] [--gitignore] [--exclude PATTERN]... [--include PATTERN]... [--transport scp|sftp|tar|auto] [--delta] [--two-way [--poll-interval DURATION]] [--on-sync COMMAND] [--build COMMAND] [--restart] [--logs [--log-source app|platform|all]] [--livereload] [-L [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT]... [--skip-host-validation]").Do(func(_ string, err error, _ string) {
+						Expect(err).To(MatchError(message))
+					})
+
+					plugin.Run(mockCLI, append([]string{"watch"}, args...))
+				},
+				Entry("without arguments", []string{}, "APP_NAME is required"),
+				Entry("with too many arguments", []string{"some-app", "../fixtures/some-dir", "some-extra-arg"}, "unexpected argument: some-extra-arg"),
+				Entry("with a missing local directory", []string{"some-app", "some-missing-dir"}, "LOCAL_DIR some-missing-dir is not a directory"),
+				Entry("with a local file", []string{"some-app", "../fixtures/some-dir/some-nested-dir/some-file"}, "LOCAL_DIR ../fixtures/some-dir/some-nested-dir/some-file is not a directory"),
+				Entry("with an unknown flag", []string{"some-app", "--some-flag"}, "flag provided but not defined: -some-flag"),
+				Entry("with a flag missing its value", []string{"some-app", "-i"}, "flag needs an argument: -i"),
+				Entry("with an invalid instance index", []string{"some-app", "-i", "some-index"}, `invalid value "some-index" for flag -i: parse error`),
+				Entry("with an invalid debounce", []string{"some-app", "--debounce", "some-duration"}, `invalid value "some-duration" for flag -debounce: parse error`),
+				Entry("with an unknown transport", []string{"some-app", "--transport", "some-transport"}, "unknown transport: some-transport"),
+				Entry("with delta mode over sftp", []string{"some-app", "--transport", "sftp", "--delta"}, "--delta cannot be used with --transport sftp"),
+				Entry("with a negative debounce", []string{"some-app", "--debounce", "-1s"}, "debounce must not be negative"),
+				Entry("with the initial sync skipped and checksums", []string{"some-app", "--skip-initial-sync", "--checksum"}, "--checksum and --delete cannot be used with --skip-initial-sync"),
+				Entry("with a build and deletes", []string{"some-app", "--build", "make", "--delete"}, "--checksum and --delete cannot be used with --build"),
+				Entry("with an unknown log source", []string{"some-app", "--logs", "--log-source", "some-source"}, "unknown log source: some-source"),
+				Entry("with a log source without logs", []string{"some-app", "--log-source", "app"}, "--log-source requires --logs"),
+				Entry("with an invalid port forwarding", []string{"some-app", "-L", "8080:localhost"}, "invalid value \"8080:localhost\" for flag -L: invalid port forwarding: 8080:localhost"),
+				Entry("with port forwarding to all instances", []string{"some-app", "--all-instances", "-L", "5005:localhost:5005"}, "-L cannot be used with --all-instances"),
+				Entry("with a negative instance index", []string{"some-app", "-i", "-1"}, "instance index must not be negative"),
+				Entry("with both an instance index and all instances", []string{"some-app", "-i", "0", "--all-instances"}, "-i and --all-instances cannot be used together"),
+				Entry("with two-way sync to all instances", []string{"some-app", "--all-instances", "--two-way"}, "--two-way cannot be used with --all-instances"),
+				Entry("with two-way sync and a build", []string{"some-app", "--two-way", "--build", "make"}, "--two-way cannot be used with --build"),
+				Entry("with a poll interval without two-way sync", []string{"some-app", "--poll-interval", "5s"}, "--poll-interval requires --two-way"),
+				Entry("with a zero poll interval", []string{"some-app", "--two-way", "--poll-interval", "0s"}, "poll interval must be positive"),
+			)
 		})
 
 		Context("when the app GUID is unavailable", func() {
@@ -70,7 +1646,7 @@ var _ = Describe("Plugin", func() {
 
 				mockUI.EXPECT().Failed("Failed to retrieve app GUID: %s", errors.New("some error"))
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
@@ -81,7 +1657,7 @@ var _ = Describe("Plugin", func() {
 
 				mockUI.EXPECT().Failed("Failed to retrieve app info: %s", errors.New("some error"))
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
@@ -94,18 +1670,283 @@ var _ = Describe("Plugin", func() {
 					Expect(args[0]).To(MatchError("invalid character 's' looking for beginning of value"))
 				})
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
-		Context("when there is not exactly one instance of the app", func() {
+		Context("when the app does not have an instance with the provided index", func() {
 			It("should output a failure message", func() {
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
 
-				mockUI.EXPECT().Failed("App must have exactly one instance to be used with cf-watch.")
+				mockUI.EXPECT().Failed("App does not have an instance with index %d.", 2)
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "-i", "2", "some-app", "../fixtures/some-dir"})
+			})
+		})
+
+		Context("when a destination is provided", func() {
+			It("should send changed files relative to that destination", func() {
+				events := make(chan Event, 1)
+				events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().SendFiles("/tmp/some-destination", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "--destination", "/tmp/some-destination/", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+
+			Context("when the destination is not an absolute path", func() {
+				It("should output a failure message", func() {
+					mockUI.EXPECT().Failed("Incorrect usage: %s\n\nUSAGE:\n   %s", errors.New("destination must be an absolute path below /"), gomock.Any())
+
+					plugin.Run(mockCLI, []string{"watch", "--destination", "some-destination", "some-app", "../fixtures/some-dir"})
+				})
+			})
+		})
+
+		Context("when ignore patterns are provided", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "cf-watch")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(dir, ".cfignore"), []byte("*.log\n"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.swp\n"), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dir)).To(Succeed())
+			})
+
+			It("should watch with a filter built from the ignore files and flags", func() {
+				events := make(chan Event)
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch(dir, gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil).Do(func(_ string, filter *Filter, _ <-chan struct{}) {
+						Expect(filter.Ignored("some-file.log")).To(BeTrue())
+						Expect(filter.Ignored("important.log")).To(BeFalse())
+						Expect(filter.Ignored("some-file.swp")).To(BeTrue())
+						Expect(filter.Ignored("node_modules/some-module")).To(BeTrue())
+						Expect(filter.Ignored("some-file")).To(BeFalse())
+					}),
+					mockUI.EXPECT().Say("Watching %s for changes...", dir),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", dir, "--gitignore", "--exclude", "node_modules", "--include", "important.log", "--skip-initial-sync"})
+			})
+
+			Context("when an ignore file cannot be read", func() {
+				It("should output a failure message", func() {
+					Expect(os.Remove(filepath.Join(dir, ".cfignore"))).To(Succeed())
+					Expect(os.Mkdir(filepath.Join(dir, ".cfignore"), 0755)).To(Succeed())
+
+					mockUI.EXPECT().Failed("Failed to read ignore file: %s", gomock.Any())
+
+					plugin.Run(mockCLI, []string{"watch", "some-app", dir})
+				})
+			})
+		})
+
+		Context("when an instance index is provided", func() {
+			It("should connect to that instance", func() {
+				events := make(chan Event)
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "-i", "1", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+		})
+
+		Context("when watching all instances", func() {
+			var (
+				mockSessions []*mocks.MockSession
+				refresh      chan time.Time
+			)
+
+			BeforeEach(func() {
+				mockSessions = []*mocks.MockSession{
+					mocks.NewMockSession(mockCtrl),
+					mocks.NewMockSession(mockCtrl),
+					mocks.NewMockSession(mockCtrl),
+				}
+				sessions := mockSessions
+				plugin.NewSession = func(config SessionConfig) Session {
+					Expect(config).To(Equal(SessionConfig{Transport: "auto", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}))
+					session := sessions[0]
+					sessions = sessions[1:]
+					return session
+				}
+				refresh = make(chan time.Time)
+				plugin.Refresh = refresh
+			})
+
+			It("should push every change to each running instance and follow instances as they come and go", func() {
+				events := make(chan Event)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 3}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				gomock.InOrder(
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid/instances").Return([]string{`{"0": {"state": "RUNNING"}, "1": {"state": "RUNNING"}, "2": {"state": "STARTING"}}` + "\n"}, nil),
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid/instances").Return([]string{`{"0": {"state": "CRASHED"}, "1": {"state": "RUNNING"}, "2": {"state": "RUNNING"}}` + "\n"}, nil),
+				)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(3)
+
+				gomock.InOrder(
+					mockSessions[0].EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Connected to instance %d", 0),
+					mockSessions[1].EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Connected to instance %d", 1),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+
+					mockSessions[0].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockSessions[1].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(errors.New("some error")),
+					mockUI.EXPECT().Warn("Failed to send %s to instance %d: %s", "some-nested-dir/some-file", 1, errors.New("some error")),
+
+					mockSessions[2].EXPECT().Connect("some-endpoint", "cf:some-guid/2", "some-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Connected to instance %d", 2),
+					mockSessions[0].EXPECT().Close().Return(nil),
+					mockUI.EXPECT().Say("Disconnected from instance %d, which is no longer running", 0),
+
+					mockSessions[1].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 1, 1, 0, 0),
+					mockSessions[2].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 2, 1, 0, 0),
+				)
+				mockSessions[1].EXPECT().Close().Return(nil)
+				mockSessions[2].EXPECT().Close().Return(nil)
+
+				go func() {
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					quiet <- time.Now()
+					refresh <- time.Now()
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					close(events)
+				}()
+
+				plugin.Run(mockCLI, []string{"watch", "--all-instances", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+
+			Context("when deltas are requested but instances fall back to sftp", func() {
+				It("should warn once that deltas are not sent", func() {
+					events := make(chan Event)
+					close(events)
+
+					sessions := []Session{&deltaSession{MockSession: mockSessions[0]}, &deltaSession{MockSession: mockSessions[1]}}
+					plugin.NewSession = func(config SessionConfig) Session {
+						Expect(config.Delta).To(BeTrue())
+						session := sessions[0]
+						sessions = sessions[1:]
+						return session
+					}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid/instances").Return([]string{`{"0": {"state": "RUNNING"}, "1": {"state": "RUNNING"}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+					gomock.InOrder(
+						mockSessions[0].EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+						mockUI.EXPECT().Warn("Instance %d does not provide scp, so --delta is ignored and files are sent over sftp in full", 0),
+						mockUI.EXPECT().Say("Connected to instance %d", 0),
+						mockSessions[1].EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+						mockUI.EXPECT().Say("Connected to instance %d", 1),
+						mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+						mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					)
+					mockSessions[0].EXPECT().Close().Return(nil)
+					mockSessions[1].EXPECT().Close().Return(nil)
+
+					plugin.Run(mockCLI, []string{"watch", "--all-instances", "some-app", "../fixtures/some-dir", "--delta", "--skip-initial-sync"})
+				})
+			})
+
+			Context("when a fatal error is reported by an instance", func() {
+				It("should disconnect from that instance and keep pushing to the others", func() {
+					events := make(chan Event)
+					go func() {
+						events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+						quiet <- time.Now()
+						events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+						close(events)
+					}()
+
+					fatal := &scp.RemoteError{Message: "scp: some-file: No space left on device"}
+
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid/instances").Return([]string{`{"0": {"state": "RUNNING"}, "1": {"state": "RUNNING"}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).Times(2)
+
+					mockSessions[0].EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil)
+					mockSessions[1].EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil)
+					mockUI.EXPECT().Say("Connected to instance %d", gomock.Any()).Times(2)
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil)
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir")
+
+					gomock.InOrder(
+						mockSessions[0].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(fatal),
+						mockUI.EXPECT().Warn("Disconnecting from instance %d: %s", 0, fatal),
+						mockSessions[0].EXPECT().Close().Return(nil),
+					)
+					mockSessions[1].EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil).Times(2)
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 1, 1, 0, 0).Times(2)
+					mockSessions[1].EXPECT().Close().Return(nil)
+
+					plugin.Run(mockCLI, []string{"watch", "--all-instances", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+				})
+			})
+
+			Context("when no instance can be connected to", func() {
+				It("should output a failure message", func() {
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid/instances").Return([]string{`{"0": {"state": "RUNNING"}}` + "\n"}, nil)
+					mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return(nil, errors.New("some error"))
+
+					mockUI.EXPECT().Warn("Instance %d: Failed to retrieve SSH code: %s", 0, errors.New("some error"))
+					mockUI.EXPECT().Failed("Failed to connect to any running instance of the app.")
+
+					plugin.Run(mockCLI, []string{"watch", "--all-instances", "some-app", "../fixtures/some-dir"})
+				})
 			})
 		})
 
@@ -117,7 +1958,7 @@ var _ = Describe("Plugin", func() {
 
 				mockUI.EXPECT().Failed("Failed to retrieve CC info: %s", errors.New("some error"))
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
@@ -131,20 +1972,54 @@ var _ = Describe("Plugin", func() {
 					Expect(args[0]).To(MatchError("invalid character 's' looking for beginning of value"))
 				})
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
-		Context("when the SSH code is unavailabe", func() {
+		Context("when the CC info does not include a host key fingerprint", func() {
 			It("should output a failure message", func() {
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint"}` + "\n"}, nil)
+
+				mockUI.EXPECT().Failed("CC info does not include an SSH host key fingerprint. Use --skip-host-validation to connect without validating the host key.")
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
+			})
+		})
+
+		Context("when host key validation is skipped", func() {
+			It("should warn and connect without a host key fingerprint", func() {
+				events := make(chan Event)
+				close(events)
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				gomock.InOrder(
+					mockUI.EXPECT().Warn("WARNING: Skipping SSH host key validation. Your SSH code and app files may be sent to an untrusted host."),
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "").Return(nil),
+					mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil),
+					mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir"),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "--skip-host-validation", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+		})
+
+		Context("when the SSH code is unavailabe", func() {
+			It("should output a failure message", func() {
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return(nil, errors.New("some error"))
 
 				mockUI.EXPECT().Failed("Failed to retrieve SSH code: %s", errors.New("some error"))
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
@@ -152,52 +2027,184 @@ var _ = Describe("Plugin", func() {
 			It("should output a failure message", func() {
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
-				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
 
-				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password").Return(errors.New("some error"))
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(errors.New("some error"))
 
 				mockUI.EXPECT().Failed("Failed to connect to app over SSH: %s", errors.New("some error"))
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-file"})
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
-		Context("when opening a file fails", func() {
+		Context("when watching the directory fails", func() {
 			It("should output a failure message", func() {
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
-				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
 
-				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password").Return(nil)
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil)
+				mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return(nil, errors.New("some error"))
+				mockSession.EXPECT().Close().Return(nil)
 
-				mockUI.EXPECT().Failed("Failed to open file: %s", gomock.Any()).Do(func(prefix string, err error) {
-					Expect(err).To(MatchError("open some-bad-file: no such file or directory"))
-				})
-				plugin.Run(mockCLI, []string{"watch", "some-app", "some-bad-file"})
+				mockUI.EXPECT().Failed("Failed to watch directory: %s", errors.New("some error"))
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir"})
 			})
 		})
 
-		Context("when creating new directory over SSH fails", func() {
-			It("should output a failure message", func() {
+		Context("when sending a file over SSH fails", func() {
+			It("should output a warning and keep watching", func() {
+				events := make(chan Event)
+				go func() {
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					quiet <- time.Now()
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					close(events)
+				}()
+
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
-				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
 				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
 
-				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password").Return(nil)
-				mockSession.EXPECT().Send("/tmp/watch", gomock.Any(), os.FileMode(0644), int64(9)).Return(errors.New("some error")).Do(func(path string, fileReadCloser io.ReadCloser, fileMode os.FileMode, length int64) {
-					data := make([]byte, 9)
-					fileReadCloser.Read(data)
-					Expect(string(data)).To(Equal("some-text"))
-				})
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil)
+				mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil)
+				mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir")
+				gomock.InOrder(
+					mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(errors.New("some error")),
+					mockUI.EXPECT().Warn("Failed to send %s to instance %d: %s", "some-nested-dir/some-file", 0, errors.New("some error")),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(nil),
+					mockUI.EXPECT().Say("Synced changes to instance %d: %d sent, %d removed, %d renamed", 0, 1, 0, 0),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+		})
+
+		Context("when the app container reports an error", func() {
+			It("should show non-fatal messages as warnings and stop on fatal ones", func() {
+				events := make(chan Event)
+				go func() {
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					quiet <- time.Now()
+					events <- Event{Op: Write, Path: "some-nested-dir/some-file"}
+					quiet <- time.Now()
+				}()
+
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 1}}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil)
+				mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil)
+
+				warning := &scp.RemoteError{Message: "scp: some-file: Permission denied", Warning: true}
+				fatal := &scp.RemoteError{Message: "scp: some-file: No space left on device"}
+
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil)
+				mockWatcher.EXPECT().Watch("../fixtures/some-dir", gomock.Any(), gomock.Any()).Return((<-chan Event)(events), nil)
+				mockUI.EXPECT().Say("Watching %s for changes...", "../fixtures/some-dir")
+				gomock.InOrder(
+					mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(warning),
+					mockUI.EXPECT().Warn("%s", warning),
+					mockSession.EXPECT().SendFiles("/home/vcap/app", "../fixtures/some-dir", []string{"some-nested-dir/some-file"}).Return(fatal),
+					mockUI.EXPECT().Failed("%s", fatal),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir", "--skip-initial-sync"})
+			})
+		})
+	})
+
+	Describe("#Run pull", func() {
+		BeforeEach(func() {
+			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("app", "some-app", "--guid").Return([]string{"some-guid\n"}, nil).AnyTimes()
+			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/apps/some-guid").Return([]string{`{"entity": {"instances": 2}}` + "\n"}, nil).AnyTimes()
+			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("curl", "/v2/info").Return([]string{`{"app_ssh_endpoint": "some-endpoint", "app_ssh_host_key_fingerprint": "some-fingerprint"}` + "\n"}, nil).AnyTimes()
+			mockCLI.EXPECT().CliCommandWithoutTerminalOutput("ssh-code").Return([]string{"some-password\n"}, nil).AnyTimes()
+		})
+
+		It("should copy the remote path from the instance to the local path", func() {
+			gomock.InOrder(
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/1", "some-password", "some-fingerprint").Return(nil),
+				mockUI.EXPECT().Say("Pulling %s from instance %d to %s...", "/home/vcap/app/some-dir", 1, "some-local-dir"),
+				mockSession.EXPECT().Receive("/home/vcap/app/some-dir", "some-local-dir").Return(nil),
+				mockUI.EXPECT().Say("Pulled %s to %s", "/home/vcap/app/some-dir", "some-local-dir"),
+				mockSession.EXPECT().Close().Return(nil),
+			)
 
-				mockUI.EXPECT().Failed("Failed to send data to app over SSH: %s", errors.New("some error"))
+			plugin.Run(mockCLI, []string{"watch", "pull", "some-app", "some-dir", "some-local-dir", "-i", "1"})
+		})
+
+		It("should copy absolute remote paths to the current directory by default", func() {
+			plugin.NewSession = func(config SessionConfig) Session {
+				Expect(config).To(Equal(SessionConfig{Transport: "sftp", KeepaliveInterval: 30 * time.Second, KeepaliveMaxMissed: 3}))
+				return mockSession
+			}
+			gomock.InOrder(
+				mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+				mockUI.EXPECT().Say("Pulling %s from instance %d to %s...", "/tmp/some-dump", 0, "."),
+				mockSession.EXPECT().Receive("/tmp/some-dump", ".").Return(nil),
+				mockUI.EXPECT().Say("Pulled %s to %s", "/tmp/some-dump", "."),
+				mockSession.EXPECT().Close().Return(nil),
+			)
+
+			plugin.Run(mockCLI, []string{"watch", "pull", "--transport", "sftp", "some-app", "/tmp/some-dump/"})
+		})
 
-				plugin.Run(mockCLI, []string{"watch", "some-app", "../fixtures/some-dir/some-nested-dir/some-file"})
+		Context("when the container cannot read some files", func() {
+			It("should warn and finish pulling", func() {
+				warning := &scp.RemoteError{Message: "scp: some-file: Permission denied", Warning: true}
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Pulling %s from instance %d to %s...", "/home/vcap/app/some-dir", 0, "."),
+					mockSession.EXPECT().Receive("/home/vcap/app/some-dir", ".").Return(warning),
+					mockUI.EXPECT().Warn("%s", warning),
+					mockUI.EXPECT().Say("Pulled %s to %s", "/home/vcap/app/some-dir", "."),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "pull", "some-app", "some-dir"})
 			})
 		})
+
+		Context("when receiving fails", func() {
+			It("should fail", func() {
+				gomock.InOrder(
+					mockSession.EXPECT().Connect("some-endpoint", "cf:some-guid/0", "some-password", "some-fingerprint").Return(nil),
+					mockUI.EXPECT().Say("Pulling %s from instance %d to %s...", "/home/vcap/app/some-dir", 0, "."),
+					mockSession.EXPECT().Receive("/home/vcap/app/some-dir", ".").Return(errors.New("some-error")),
+					mockUI.EXPECT().Failed("Failed to pull %s: %s", "/home/vcap/app/some-dir", errors.New("some-error")),
+					mockSession.EXPECT().Close().Return(nil),
+				)
+
+				plugin.Run(mockCLI, []string{"watch", "pull", "some-app", "some-dir"})
+			})
+		})
+
+		Context("when the app does not have the instance", func() {
+			It("should fail without connecting", func() {
+				mockUI.EXPECT().Failed("App does not have an instance with index %d.", 2)
+
+				plugin.Run(mockCLI, []string{"watch", "pull", "some-app", "some-dir", "-i", "2"})
+			})
+		})
+
+		DescribeTable("with incorrect usage",
+			func(args []string, message string) {
+				mockUI.EXPECT().Failed("Incorrect usage: %s\n\nUSAGE:\n   %s", errors.New(message), "cf watch pull APP_NAME REMOTE_PATH [LOCAL_PATH] [-i INDEX] [--transport scp|sftp|tar|auto] [--skip-host-validation]")
+
+				plugin.Run(mockCLI, append([]string{"watch", "pull"}, args...))
+			},
+			Entry("without an app", []string{}, "APP_NAME is required"),
+			Entry("without a remote path", []string{"some-app"}, "REMOTE_PATH is required"),
+			Entry("with too many arguments", []string{"some-app", "some-dir", "some-local-dir", "some-extra"}, "unexpected argument: some-extra"),
+			Entry("with a negative index", []string{"some-app", "some-dir", "-i", "-1"}, "instance index must not be negative"),
+			Entry("with an unknown transport", []string{"some-app", "some-dir", "--transport", "some-transport"}, "unknown transport: some-transport"),
+		)
 	})
 
 	Describe("#GetMetadata", func() {
@@ -206,7 +2213,35 @@ var _ = Describe("Plugin", func() {
 				Name: "Watch",
 				Commands: []cliplugin.Command{
 					cliplugin.Command{
-						Name: "watch",
+						Name:     "watch",
+						HelpText: "Sync local changes to a running app's container as they happen, or pull files from it",
+						UsageDetails: cliplugin.Usage{
+							Usage: "cf watch APP_NAME [LOCAL_DIR] [--destination REMOTE_DIR] [-i INDEX | --all-instances] [--debounce DURATION] [--skip-initial-sync | [--checksum] [--delete]] [--gitignore] [--exclude PATTERN]... [--include PATTERN]... [--transport scp|sftp|tar|auto] [--delta] [--two-way [--poll-interval DURATION]] [--on-sync COMMAND] [--build COMMAND] [--restart] [--logs [--log-source app|platform|all]] [--livereload] [-L [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT]... [--skip-host-validation]\n   cf watch pull APP_NAME REMOTE_PATH [LOCAL_PATH] [-i INDEX] [--transport scp|sftp|tar|auto] [--skip-host-validation]",
+							Options: map[string]string{
+								"-destination":          "Directory in the app container that LOCAL_DIR is synced to (Default: /home/vcap/app)",
+								"i":                     "Index of the app instance to sync to (Default: 0)",
+								"-all-instances":        "Sync to every running app instance",
+								"-skip-host-validation": "Skip SSH host key validation (insecure)",
+								"-debounce":             "Time to wait for further changes before syncing a batch (Default: 200ms)",
+								"-skip-initial-sync":    "Only send changes made after watching starts",
+								"-checksum":             "Compare files by checksum instead of size and modification time during the initial sync",
+								"-delete":               "Remove files that only exist in the app container during the initial sync",
+								"-gitignore":            "Also skip paths matched by LOCAL_DIR/.gitignore",
+								"-exclude":              "Skip paths matching a .cfignore-style pattern (may be repeated)",
+								"-include":              "Sync paths matching a .cfignore-style pattern even if they are ignored (may be repeated)",
+								"-delta":                "Send large changed files as the difference from the copy in the app container",
+								"-two-way":              "Also pull files that change in the app container. A file changed on both sides since it was last synced is reported as a conflict, and neither copy is overwritten until one of them changes again",
+								"-poll-interval":        "Time between listings of the app container for changes with --two-way (Default: 2s)",
+								"-on-sync":              "Shell command to run in REMOTE_DIR after each batch of changes is synced, such as kill -HUP 1",
+								"-build":                "Shell command to run in LOCAL_DIR with GOOS=linux and GOARCH=amd64 when files change. Only the files that it writes to $CF_WATCH_BUILD_DIR are synced",
+								"-restart":              "Run the app's start command under a supervisor in the container, and restart it after each sync instead of restaging. Push the app with -u process -c 'sleep infinity' so that its own process leaves the port free",
+								"-logs":                 "Show the app's logs along with sync events",
+								"-log-source":           "Which logs to show: app for the app's own output, platform for the router, staging and other components, or all (Default: all)",
+								"-livereload":           "Run a LiveReload server on localhost:35729 that reloads connected browsers after each synced batch, or only their stylesheets when only CSS changed. Use a LiveReload browser extension, or add <script src=\"http://localhost:35729/livereload.js\"></script> to the page",
+								"L":                     "Forward a local port to a port reachable from the app instance, as [LOCAL_ADDRESS:]LOCAL_PORT:REMOTE_HOST:REMOTE_PORT, for as long as the watch runs (may be repeated)",
+								"-transport":            "How files are transferred: scp, sftp, tar, or auto to use scp where available and tar for large batches (Default: auto)",
+							},
+						},
 					},
 				},
 			}))
@@ -0,0 +1,125 @@
+package watch
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+const pullUsage = "cf watch pull APP_NAME REMOTE_PATH [LOCAL_PATH] [-i INDEX] [--transport scp|sftp|tar|auto] [--skip-host-validation]"
+
+type pullOptions struct {
+	appName            string
+	remotePath         string
+	localPath          string
+	instanceIndex      int
+	transport          string
+	skipHostValidation bool
+}
+
+// parsePullOptions parses the arguments that follow `watch pull`. Relative
+// remote paths are resolved against the default destination, where the app
+// lives.
+func parsePullOptions(args []string) (*pullOptions, error) {
+	opts := &pullOptions{}
+	flags := flag.NewFlagSet("pull", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.IntVar(&opts.instanceIndex, "i", 0, "")
+	flags.StringVar(&opts.transport, "transport", "auto", "")
+	flags.BoolVar(&opts.skipHostValidation, "skip-host-validation", false, "")
+
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch len(positional) {
+	case 0:
+		return nil, errors.New("APP_NAME is required")
+	case 1:
+		return nil, errors.New("REMOTE_PATH is required")
+	case 2:
+		opts.localPath = "."
+	case 3:
+		opts.localPath = positional[2]
+	default:
+		return nil, fmt.Errorf("unexpected argument: %s", positional[3])
+	}
+	opts.appName = positional[0]
+	opts.remotePath = positional[1]
+	if !path.IsAbs(opts.remotePath) {
+		opts.remotePath = path.Join(defaultDestination, opts.remotePath)
+	}
+	opts.remotePath = path.Clean(opts.remotePath)
+
+	if opts.instanceIndex < 0 {
+		return nil, errors.New("instance index must not be negative")
+	}
+	if opts.transport != "scp" && opts.transport != "sftp" && opts.transport != "tar" && opts.transport != "auto" {
+		return nil, fmt.Errorf("unknown transport: %s", opts.transport)
+	}
+	return opts, nil
+}
+
+// pull copies a file or directory from an app instance to the local tree,
+// connecting the same way as Run.
+func (p *Plugin) pull(cli CLI, args []string) {
+	opts, err := parsePullOptions(args)
+	if err != nil {
+		p.UI.Failed("Incorrect usage: %s\n\nUSAGE:\n   %s", err, pullUsage)
+		return
+	}
+
+	appGUID, app, ok := p.lookupApp(cli, opts.appName)
+	if !ok {
+		return
+	}
+	if opts.instanceIndex >= app.Instances {
+		p.UI.Failed("App does not have an instance with index %d.", opts.instanceIndex)
+		return
+	}
+	endpoint, hostKeyFingerprint, ok := p.lookupSSH(cli, opts.skipHostValidation)
+	if !ok {
+		return
+	}
+
+	instances := &instances{
+		cli: cli,
+		newSession: func() Session {
+			return p.NewSession(SessionConfig{
+				Transport:          opts.transport,
+				KeepaliveInterval:  defaultKeepaliveInterval,
+				KeepaliveMaxMissed: defaultKeepaliveMaxMissed,
+			})
+		},
+		appGUID:     appGUID,
+		endpoint:    endpoint,
+		fingerprint: hostKeyFingerprint,
+	}
+	defer instances.close()
+	if !instances.connect(opts.instanceIndex, p.UI.Failed) {
+		return
+	}
+
+	// Files that the container cannot read are skipped and reported, as
+	// when sending.
+	p.UI.Say("Pulling %s from instance %d to %s...", opts.remotePath, opts.instanceIndex, opts.localPath)
+	err = instances.sessions[opts.instanceIndex].Receive(opts.remotePath, opts.localPath)
+	if remoteErr, ok := err.(RemoteError); ok && !remoteErr.Fatal() {
+		p.UI.Warn("%s", remoteErr)
+	} else if err != nil {
+		p.UI.Failed("Failed to pull %s: %s", opts.remotePath, err)
+		return
+	}
+	p.UI.Say("Pulled %s to %s", opts.remotePath, opts.localPath)
+}
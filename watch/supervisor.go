@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+const supervisorDir = "/home/vcap/.cf-watch"
+
+// supervisorScript stops the copy of the app that it started last, if any,
+// and starts the command given as its argument in a new process group, with
+// the environment that .profile.d provides to the app's own process. Output
+// is appended to app.log next to the script.
+const supervisorScript = `#!/bin/sh
+state=$(dirname "$0")
+if [ -f "$state/app.pid" ]; then
+	pid=$(cat "$state/app.pid")
+	rm -f "$state/app.pid"
+	if kill -TERM "-$pid" 2>/dev/null; then
+		i=0
+		while [ $i -lt 50 ] && kill -0 "-$pid" 2>/dev/null; do
+			sleep 0.1
+			i=$((i + 1))
+		done
+		kill -KILL "-$pid" 2>/dev/null
+	fi
+fi
+setsid sh -c 'for f in "$HOME"/app/.profile.d/*.sh; do [ -f "$f" ] && . "$f"; done; [ -f "$HOME/app/.profile" ] && . "$HOME/app/.profile"; exec sh -c "$1"' sh "$1" >>"$state/app.log" 2>&1 </dev/null &
+echo $! >"$state/app.pid"
+`
+
+// installSupervisor writes the supervisor script to the container and
+// returns the start command recorded in the droplet's staging_info.yml, or
+// an empty string if there is none.
+func installSupervisor(session Session, remoteDir string) (string, error) {
+	command := "mkdir -p " + supervisorDir + " && cat >" + supervisorDir + "/supervise <<'CF_WATCH_EOF' && chmod 755 " + supervisorDir + "/supervise && cat /home/vcap/staging_info.yml 2>/dev/null; true\n" +
+		supervisorScript + "CF_WATCH_EOF\n"
+
+	var stdout, stderr bytes.Buffer
+	if err := session.Run(remoteDir, command, &stdout, &stderr); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.New(message)
+		}
+		return "", err
+	}
+
+	// staging_info.yml is written as JSON by current lifecycles, which YAML
+	// also accepts.
+	var stagingInfo struct {
+		StartCommand string `yaml:"start_command"`
+	}
+	if err := yaml.Unmarshal(stdout.Bytes(), &stagingInfo); err != nil {
+		return "", err
+	}
+	return stagingInfo.StartCommand, nil
+}
+
+// restart starts the app's start command under the supervisor, replacing the
+// copy that it started before.
+func (p *Plugin) restart(opts *options, index int, session Session) error {
+	p.UI.Say("Restarting app on instance %d", index)
+	err := session.Run(opts.destination, supervisorDir+"/supervise "+remote.ShellQuote(opts.startCommand), p.Stdout, p.Stderr)
+	if err != nil {
+		return p.warn(err, "Failed to restart app on instance %d: %s", index)
+	}
+	return nil
+}
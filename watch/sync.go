@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// initialSync brings an app instance up to date with the local directory
+// before live changes are sent. Remote files are listed in one exec and
+// compared with the local tree by size and modification time, or by checksum
+// if requested. Files that only exist remotely are removed if requested, and
+// are otherwise kept, since staging may have created them. Once the instance
+// is up to date, afterSync is run.
+func (p *Plugin) initialSync(opts *options, filter *Filter, index int, session Session) error {
+	remoteFiles, err := session.List(opts.destination, opts.checksum)
+	if err != nil {
+		return p.warn(err, "Failed to list files on instance %d: %s", index)
+	}
+
+	local, unreadable, err := scan(opts.dir, filter)
+	if err != nil {
+		p.UI.Warn("Failed to read %s: %s", opts.dir, err)
+		return nil
+	}
+	if len(unreadable) > 0 {
+		p.UI.Warn("Skipped %s, which cannot be read", describe(unreadable))
+	}
+
+	var added, updated, removed []string
+	kept := 0
+	for relPath, info := range local {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		remoteFile, ok := remoteFiles[relPath]
+		if !ok {
+			added = append(added, relPath)
+		} else if differs(filepath.Join(opts.dir, filepath.FromSlash(relPath)), info, remoteFile, opts.checksum) {
+			updated = append(updated, relPath)
+		}
+	}
+	for relPath := range remoteFiles {
+		if info, ok := local[relPath]; ok && info.Mode().IsRegular() {
+			continue
+		}
+		if filter.Ignored(relPath) || withinAny(relPath, unreadable) {
+			continue
+		}
+		if opts.delete {
+			removed = append(removed, relPath)
+		} else {
+			kept++
+		}
+	}
+
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		if err := session.Remove(opts.destination, removed); err != nil {
+			return p.warn(err, "Failed to remove %s from instance %d: %s", describe(removed), index)
+		}
+	}
+	if sends := append(append([]string(nil), added...), updated...); len(sends) > 0 {
+		sort.Strings(sends)
+		if err := session.SendFiles(opts.destination, opts.dir, sends); err != nil {
+			return p.warn(err, "Failed to send %s to instance %d: %s", describe(sends), index)
+		}
+	}
+
+	p.UI.Say("Synced instance %d: %d added, %d updated, %d removed", index, len(added), len(updated), len(removed))
+	if kept > 0 {
+		p.UI.Say("Kept %d files that only exist on instance %d. Use --delete to remove them.", kept, index)
+	}
+	return p.afterSync(opts, index, session)
+}
+
+func differs(localPath string, info os.FileInfo, remoteFile remote.File, checksum bool) bool {
+	if info.Size() != remoteFile.Size {
+		return true
+	}
+	if !checksum {
+		return info.ModTime().Unix() != remoteFile.ModTime.Unix()
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return true
+	}
+	return hex.EncodeToString(hash.Sum(nil)) != remoteFile.Hash
+}
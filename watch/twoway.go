@@ -0,0 +1,254 @@
+package watch
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pivotal-cf/cf-watch/remote"
+)
+
+// twoWay holds, for --two-way, the state of every path on both sides as of
+// the last time it was synced. A path that has since changed on one side is
+// copied to the other, and a path that changed on both is reported as a
+// conflict and left as it is on each side.
+type twoWay struct {
+	// synced is nil until both sides are first listed, and again whenever
+	// the container can no longer be compared with it.
+	synced map[string]syncedPath
+
+	// session is the connection that synced was recorded over. The
+	// container may have been restarted while it was unreachable, so a new
+	// connection starts from a new baseline.
+	session Session
+
+	// changed holds the paths copied or removed by the last reconcile.
+	changed []string
+}
+
+type syncedPath struct {
+	local, remote stamp
+}
+
+// stamp fingerprints a regular file by its size and modification time, to
+// the second. The zero stamp stands for a missing file.
+type stamp struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+func localStamp(info os.FileInfo) stamp {
+	if info == nil || !info.Mode().IsRegular() {
+		return stamp{}
+	}
+	return stamp{exists: true, size: info.Size(), modTime: info.ModTime().Unix()}
+}
+
+func remoteStamp(file remote.File, ok bool) stamp {
+	if !ok {
+		return stamp{}
+	}
+	return stamp{exists: true, size: file.Size, modTime: file.ModTime.Unix()}
+}
+
+// reconcile lists both sides in full and compares each path with its state
+// at the last sync. Remote changes are pulled and local changes are sent,
+// so changes are never echoed back to the side they came from, and one
+// summary line is shown for whatever succeeded. The first call only records
+// the current state.
+func (p *Plugin) reconcile(opts *options, filter *Filter, tw *twoWay, index int, session Session) error {
+	tw.changed = nil
+	remoteFiles, err := session.List(opts.destination, false)
+	if err != nil {
+		return p.warn(err, "Failed to list files on instance %d: %s", index)
+	}
+	// A container that lists no files although some were synced, such as
+	// one whose destination is missing, has most likely been replaced
+	// rather than emptied, so no local file is removed on its account.
+	if len(remoteFiles) == 0 && tw.syncedRemotely() {
+		p.UI.Warn("Found no files in %s on instance %d. Local files were kept and will be synced again.", opts.destination, index)
+		tw.synced = nil
+		return nil
+	}
+	local, unreadable, err := scan(opts.dir, filter)
+	if err != nil {
+		p.UI.Warn("Failed to read %s: %s", opts.dir, err)
+		return nil
+	}
+
+	all := map[string]bool{}
+	for relPath := range local {
+		all[relPath] = true
+	}
+	for relPath := range remoteFiles {
+		all[relPath] = true
+	}
+	for relPath := range tw.synced {
+		all[relPath] = true
+	}
+
+	first := tw.synced == nil
+	if first {
+		tw.synced = map[string]syncedPath{}
+	}
+	var sends, removes, pulls, deletes, conflicts []string
+	for relPath := range all {
+		if filter.Ignored(relPath) || withinAny(relPath, unreadable) {
+			continue
+		}
+		remoteFile, ok := remoteFiles[relPath]
+		current := syncedPath{local: localStamp(local[relPath]), remote: remoteStamp(remoteFile, ok)}
+		last := tw.synced[relPath]
+		if first {
+			last = current
+		}
+		localChanged, remoteChanged := current.local != last.local, current.remote != last.remote
+
+		// A conflict is recorded as synced, so that neither copy is
+		// overwritten until one of them changes again, which is then copied
+		// to the other side as usual.
+		switch {
+		case localChanged && remoteChanged:
+			if current.local != current.remote {
+				conflicts = append(conflicts, relPath)
+			}
+		case localChanged && current.local.exists:
+			sends = append(sends, relPath)
+			continue
+		case localChanged:
+			removes = append(removes, relPath)
+			continue
+		case remoteChanged && current.remote.exists:
+			pulls = append(pulls, relPath)
+			continue
+		case remoteChanged:
+			deletes = append(deletes, relPath)
+			continue
+		}
+		tw.record(relPath, current)
+	}
+
+	sort.Strings(conflicts)
+	for _, relPath := range conflicts {
+		p.UI.Warn("Conflict: %s changed both locally and on instance %d. Neither copy was overwritten.", relPath, index)
+	}
+	pulled, err := p.pullRemote(opts, tw, pulls, remoteFiles, index, session)
+	if err != nil {
+		return err
+	}
+	deleted := p.removeLocal(opts, tw, deletes)
+
+	synced := true
+	if len(removes) > 0 {
+		sort.Strings(removes)
+		if err := session.Remove(opts.destination, removes); err != nil {
+			if err := p.warn(err, "Failed to remove %s from instance %d: %s", describe(removes), index); err != nil {
+				return err
+			}
+			removes, synced = nil, false
+		}
+	}
+	if len(sends) > 0 {
+		sort.Strings(sends)
+		if err := session.SendFiles(opts.destination, opts.dir, sends); err != nil {
+			if err := p.warn(err, "Failed to send %s to instance %d: %s", describe(sends), index); err != nil {
+				return err
+			}
+			sends, synced = nil, false
+		}
+	}
+	if len(sends)+len(removes)+len(pulled)+len(deleted) > 0 {
+		p.UI.Say("Synced changes with instance %d: %d sent, %d removed, %d pulled, %d removed locally", index, len(sends), len(removes), len(pulled), len(deleted))
+	}
+	if len(removes) == 0 && len(sends) == 0 {
+		return nil
+	}
+
+	// Remote modification times are only known once the files are listed
+	// again, since they are only preserved by some transports. Paths that
+	// failed are recorded later, once they are retried.
+	if remoteFiles, err = session.List(opts.destination, false); err != nil {
+		return p.warn(err, "Failed to list files on instance %d: %s", index)
+	}
+	for _, relPath := range append(removes, sends...) {
+		remoteFile, ok := remoteFiles[relPath]
+		tw.record(relPath, syncedPath{local: localStamp(local[relPath]), remote: remoteStamp(remoteFile, ok)})
+		tw.changed = append(tw.changed, relPath)
+	}
+	sort.Strings(tw.changed)
+	if !synced {
+		return nil
+	}
+	return p.afterSync(opts, index, session)
+}
+
+// pullRemote copies files that changed only in the container to the local
+// directory, with their modes and modification times, and returns the paths
+// that were copied.
+func (p *Plugin) pullRemote(opts *options, tw *twoWay, pulls []string, remoteFiles map[string]remote.File, index int, session Session) ([]string, error) {
+	sort.Strings(pulls)
+	var pulled []string
+	for _, relPath := range pulls {
+		localPath := filepath.Join(opts.dir, filepath.FromSlash(relPath))
+		err := os.MkdirAll(filepath.Dir(localPath), 0755)
+		if err == nil {
+			err = session.Receive(path.Join(opts.destination, relPath), localPath)
+		}
+		if err != nil {
+			if err := p.warn(err, "Failed to pull %s from instance %d: %s", relPath, index); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		info, err := os.Stat(localPath)
+		if err != nil {
+			continue
+		}
+		remoteFile, ok := remoteFiles[relPath]
+		tw.record(relPath, syncedPath{local: localStamp(info), remote: remoteStamp(remoteFile, ok)})
+		pulled = append(pulled, relPath)
+	}
+	tw.changed = append(tw.changed, pulled...)
+	return pulled, nil
+}
+
+// removeLocal removes local files that were removed only in the container,
+// and returns the paths that were removed.
+func (p *Plugin) removeLocal(opts *options, tw *twoWay, deletes []string) []string {
+	sort.Strings(deletes)
+	var deleted []string
+	for _, relPath := range deletes {
+		err := os.Remove(filepath.Join(opts.dir, filepath.FromSlash(relPath)))
+		if err != nil && !os.IsNotExist(err) {
+			p.UI.Warn("Failed to remove %s: %s", relPath, err)
+			continue
+		}
+		tw.record(relPath, syncedPath{})
+		deleted = append(deleted, relPath)
+	}
+	tw.changed = append(tw.changed, deleted...)
+	return deleted
+}
+
+// syncedRemotely reports whether any path existed in the container as of the
+// last sync.
+func (tw *twoWay) syncedRemotely() bool {
+	for _, state := range tw.synced {
+		if state.remote.exists {
+			return true
+		}
+	}
+	return false
+}
+
+// record sets the state of a path as of the last sync, forgetting paths that
+// are missing on both sides.
+func (tw *twoWay) record(relPath string, state syncedPath) {
+	if state == (syncedPath{}) {
+		delete(tw.synced, relPath)
+		return
+	}
+	tw.synced[relPath] = state
+}
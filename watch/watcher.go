@@ -0,0 +1,223 @@
+package watch
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Op int
+
+const (
+	Create Op = iota + 1
+	Write
+	Remove
+	Rename
+)
+
+func (o Op) String() string {
+	switch o {
+	case Create:
+		return "create"
+	case Write:
+		return "write"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// Event describes a change to a path below the watched directory. Paths are
+// slash-separated and relative to the watched directory.
+type Event struct {
+	Op      Op
+	Path    string
+	OldPath string
+	IsDir   bool
+}
+
+// Poller detects changes by periodically walking the watched directory and
+// comparing the result with the previous walk. Paths ignored by the filter
+// are not walked, so ignored directories are never descended into. Paths
+// below entries that cannot be read keep their last known state until they
+// can be read again.
+type Poller struct {
+	Interval time.Duration
+}
+
+func (p *Poller) Watch(dir string, filter *Filter, stop <-chan struct{}) (<-chan Event, error) {
+	snapshot, _, err := scan(dir, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			// The directory itself may be briefly missing while it is
+			// replaced, so a failed walk is retried at the next tick.
+			next, unreadable, err := scan(dir, filter)
+			if err != nil {
+				continue
+			}
+			for relPath, info := range snapshot {
+				if _, ok := next[relPath]; !ok && withinAny(relPath, unreadable) {
+					next[relPath] = info
+				}
+			}
+			for _, event := range diff(snapshot, next) {
+				select {
+				case events <- event:
+				case <-stop:
+					return
+				}
+			}
+			snapshot = next
+		}
+	}()
+	return events, nil
+}
+
+// scan lists the paths below dir that the filter does not ignore. Entries
+// that cannot be read, such as directories without read permission, are
+// returned as unreadable instead of failing the walk, since the paths below
+// them are unknown rather than removed.
+func scan(dir string, filter *Filter) (map[string]os.FileInfo, []string, error) {
+	snapshot := map[string]os.FileInfo{}
+	var unreadable []string
+	err := filepath.Walk(dir, func(walkPath string, info os.FileInfo, err error) error {
+		if walkPath == dir {
+			return err
+		}
+		if err != nil && os.IsNotExist(err) {
+			return nil
+		}
+		relPath, relErr := filepath.Rel(dir, walkPath)
+		if relErr != nil {
+			return relErr
+		}
+		relPath = filepath.ToSlash(relPath)
+		if info != nil && info.IsDir() && filter.skipsDir(relPath) {
+			return filepath.SkipDir
+		}
+		if filter.Ignored(relPath) {
+			return nil
+		}
+		if info != nil {
+			snapshot[relPath] = info
+		}
+		if err != nil {
+			unreadable = append(unreadable, relPath)
+		}
+		return nil
+	})
+	return snapshot, unreadable, err
+}
+
+// withinAny reports whether relPath is one of dirs or a path below one.
+func withinAny(relPath string, dirs []string) bool {
+	for _, dir := range dirs {
+		if within(relPath, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func diff(previous, next map[string]os.FileInfo) []Event {
+	var created, removed, written []string
+	var events []Event
+
+	for relPath, info := range next {
+		previousInfo, ok := previous[relPath]
+		if !ok {
+			created = append(created, relPath)
+			continue
+		}
+		if !info.IsDir() && changed(previousInfo, info) {
+			written = append(written, relPath)
+		}
+	}
+	for relPath := range previous {
+		if _, ok := next[relPath]; !ok {
+			removed = append(removed, relPath)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(written)
+	sort.Sort(sort.Reverse(sort.StringSlice(removed)))
+
+	renamedFrom := map[string]string{}
+	for _, newPath := range created {
+		for _, oldPath := range removed {
+			if _, ok := renamedFrom[oldPath]; ok {
+				continue
+			}
+			if os.SameFile(previous[oldPath], next[newPath]) {
+				renamedFrom[oldPath] = newPath
+				break
+			}
+		}
+	}
+	renamedTo := map[string]string{}
+	for oldPath, newPath := range renamedFrom {
+		renamedTo[newPath] = oldPath
+	}
+
+	for _, relPath := range removed {
+		if _, ok := renamedFrom[relPath]; ok {
+			continue
+		}
+		events = append(events, Event{Op: Remove, Path: relPath, IsDir: previous[relPath].IsDir()})
+	}
+	for _, relPath := range created {
+		info := next[relPath]
+		oldPath, ok := renamedTo[relPath]
+		if !ok {
+			events = append(events, Event{Op: Create, Path: relPath, IsDir: info.IsDir()})
+			continue
+		}
+		if movedWithParent(oldPath, relPath, renamedFrom) {
+			continue
+		}
+		events = append(events, Event{Op: Rename, Path: relPath, OldPath: oldPath, IsDir: info.IsDir()})
+		if !info.IsDir() && changed(previous[oldPath], info) {
+			events = append(events, Event{Op: Write, Path: relPath})
+		}
+	}
+	for _, relPath := range written {
+		events = append(events, Event{Op: Write, Path: relPath})
+	}
+	return events
+}
+
+func changed(previous, next os.FileInfo) bool {
+	return previous.Size() != next.Size() ||
+		previous.Mode() != next.Mode() ||
+		!previous.ModTime().Equal(next.ModTime())
+}
+
+func movedWithParent(oldPath, newPath string, renamedFrom map[string]string) bool {
+	for oldDir, newDir := path.Dir(oldPath), path.Dir(newPath); oldDir != "." && newDir != "."; oldDir, newDir = path.Dir(oldDir), path.Dir(newDir) {
+		if renamedFrom[oldDir] == newDir && strings.TrimPrefix(oldPath, oldDir) == strings.TrimPrefix(newPath, newDir) {
+			return true
+		}
+	}
+	return false
+}
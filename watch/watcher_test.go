@@ -0,0 +1,172 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/pivotal-cf/cf-watch/watch"
+)
+
+var _ = Describe("Poller", func() {
+	var (
+		poller *Poller
+		dir    string
+		stop   chan struct{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cf-watch")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file"), []byte("some-text"), 0644)).To(Succeed())
+
+		poller = &Poller{Interval: 10 * time.Millisecond}
+		stop = make(chan struct{})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Describe("#Watch", func() {
+		It("should report created files and directories", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+			defer close(stop)
+
+			Expect(os.Mkdir(filepath.Join(dir, "some-new-dir"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "some-new-dir", "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+
+			Eventually(events).Should(Receive(Equal(Event{Op: Create, Path: "some-new-dir", IsDir: true})))
+			Eventually(events).Should(Receive(Equal(Event{Op: Create, Path: "some-new-dir/some-new-file"})))
+		})
+
+		It("should report written files", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+			defer close(stop)
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file"), []byte("some-other-text"), 0644)).To(Succeed())
+
+			Eventually(events).Should(Receive(Equal(Event{Op: Write, Path: "some-dir/some-file"})))
+		})
+
+		It("should report removed files and directories deepest first", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+			defer close(stop)
+
+			Expect(os.RemoveAll(filepath.Join(dir, "some-dir"))).To(Succeed())
+
+			Eventually(events).Should(Receive(Equal(Event{Op: Remove, Path: "some-dir/some-file"})))
+			Eventually(events).Should(Receive(Equal(Event{Op: Remove, Path: "some-dir", IsDir: true})))
+		})
+
+		It("should report renamed directories without reporting their contents", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+			defer close(stop)
+
+			Expect(os.Rename(filepath.Join(dir, "some-dir"), filepath.Join(dir, "some-renamed-dir"))).To(Succeed())
+
+			Eventually(events).Should(Receive(Equal(Event{Op: Rename, Path: "some-renamed-dir", OldPath: "some-dir", IsDir: true})))
+			Consistently(events).ShouldNot(Receive())
+		})
+
+		It("should report renamed files", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+			defer close(stop)
+
+			Expect(os.Rename(filepath.Join(dir, "some-dir", "some-file"), filepath.Join(dir, "some-renamed-file"))).To(Succeed())
+
+			Eventually(events).Should(Receive(Equal(Event{Op: Rename, Path: "some-renamed-file", OldPath: "some-dir/some-file"})))
+		})
+
+		It("should close the event channel when stopped", func() {
+			events, err := poller.Watch(dir, nil, stop)
+			Expect(err).NotTo(HaveOccurred())
+
+			close(stop)
+			Eventually(events).Should(BeClosed())
+		})
+
+		Context("when a filter is provided", func() {
+			It("should not report ignored paths", func() {
+				events, err := poller.Watch(dir, NewFilter("*.log", "some-ignored-dir"), stop)
+				Expect(err).NotTo(HaveOccurred())
+				defer close(stop)
+
+				Expect(os.Mkdir(filepath.Join(dir, "some-ignored-dir"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-ignored-dir", "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file.log"), []byte("some-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+
+				Eventually(events).Should(Receive(Equal(Event{Op: Create, Path: "some-dir/some-new-file"})))
+				Consistently(events).ShouldNot(Receive())
+			})
+
+			It("should report re-included paths below ignored directories", func() {
+				events, err := poller.Watch(dir, NewFilter("some-dir", "!some-dir/some-new-file"), stop)
+				Expect(err).NotTo(HaveOccurred())
+				defer close(stop)
+
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file"), []byte("some-other-text"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+
+				Eventually(events).Should(Receive(Equal(Event{Op: Create, Path: "some-dir/some-new-file"})))
+				Consistently(events).ShouldNot(Receive())
+			})
+		})
+
+		Context("when a subdirectory cannot be read", func() {
+			BeforeEach(func() {
+				if os.Geteuid() == 0 {
+					Skip("permissions are not enforced for root")
+				}
+				Expect(os.Chmod(filepath.Join(dir, "some-dir"), 0)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.Chmod(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+			})
+
+			It("should keep reporting changes elsewhere", func() {
+				events, err := poller.Watch(dir, nil, stop)
+				Expect(err).NotTo(HaveOccurred())
+				defer close(stop)
+
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-new-file"), []byte("some-text"), 0644)).To(Succeed())
+
+				Eventually(events).Should(Receive(Equal(Event{Op: Create, Path: "some-new-file"})))
+			})
+
+			It("should not report its known contents as removed", func() {
+				Expect(os.Chmod(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+				events, err := poller.Watch(dir, nil, stop)
+				Expect(err).NotTo(HaveOccurred())
+				defer close(stop)
+
+				Expect(os.Chmod(filepath.Join(dir, "some-dir"), 0)).To(Succeed())
+				Consistently(events).ShouldNot(Receive())
+
+				Expect(os.Chmod(filepath.Join(dir, "some-dir"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "some-dir", "some-file"), []byte("some-other-text"), 0644)).To(Succeed())
+				Eventually(events).Should(Receive(Equal(Event{Op: Write, Path: "some-dir/some-file"})))
+			})
+		})
+
+		Context("when the directory does not exist", func() {
+			It("should return an error", func() {
+				_, err := poller.Watch(filepath.Join(dir, "some-missing-dir"), nil, stop)
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+		})
+	})
+})
@@ -0,0 +1,289 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// MaxMessageSize bounds the messages that are read, since lengths are sent
+// by the peer.
+const MaxMessageSize = 1 << 20
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// acceptGUID is appended to the handshake key by the server, as defined by
+// RFC 6455.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Conn is a websocket connection that implements the subset of RFC 6455
+// needed by cf-watch: whole text and binary messages, pings, and closing.
+// Extensions and subprotocols are not negotiated.
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	client bool
+
+	writeLock sync.Mutex
+}
+
+// Dial opens a websocket connection to the path below a ws:// or wss://
+// endpoint, sending the extra headers with the handshake.
+func Dial(endpoint, path string, header http.Header, skipSSLValidation bool) (*Conn, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	host := target.Host
+	var netConn net.Conn
+	switch target.Scheme {
+	case "wss":
+		if target.Port() == "" {
+			host += ":443"
+		}
+		netConn, err = tls.Dial("tcp", host, &tls.Config{ServerName: target.Hostname(), InsecureSkipVerify: skipSSLValidation})
+	case "ws":
+		if target.Port() == "" {
+			host += ":80"
+		}
+		netConn, err = net.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported endpoint: %s", endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{Conn: netConn, reader: bufio.NewReader(netConn), client: true}
+	if err := c.handshake(target.Host, path, header); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) handshake(host, path string, header http.Header) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request, err := http.NewRequest("GET", "http://"+host+path, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err := request.Write(c.Conn); err != nil {
+		return err
+	}
+
+	response, err := http.ReadResponse(c.reader, request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("unexpected response from %s: %s", host, response.Status)
+	}
+	if response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return errors.New("invalid websocket handshake")
+	}
+	return nil
+}
+
+// Upgrade completes the handshake for a websocket request received by an
+// HTTP handler, and takes over its connection. Requests that are not
+// websocket handshakes are answered with an error.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != "GET" || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+
+	netConn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &Conn{Conn: netConn, reader: buffer.Reader}, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. It returns io.EOF once the peer closes the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, header); err != nil {
+			return nil, err
+		}
+		final := header[0]&0x80 != 0
+		opcode := header[0] & 0x0f
+		masked := header[1]&0x80 != 0
+		if masked == c.client {
+			return nil, errors.New("websocket frame masked incorrectly")
+		}
+
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			if _, err := io.ReadFull(c.reader, extended); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			if _, err := io.ReadFull(c.reader, extended); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(extended)
+		}
+		if length > MaxMessageSize || uint64(len(message))+length > MaxMessageSize {
+			return nil, fmt.Errorf("websocket message exceeds %d bytes", MaxMessageSize)
+		}
+
+		var mask []byte
+		if masked {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(c.reader, mask); err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case opClose:
+			c.writeFrame(opClose, nil)
+			return nil, io.EOF
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opContinuation, opText, opBinary:
+			message = append(message, payload...)
+			if final {
+				return message, nil
+			}
+		}
+	}
+}
+
+// WriteText sends a text message. It is safe to call while another
+// goroutine reads.
+func (c *Conn) WriteText(text []byte) error {
+	return c.writeFrame(opText, text)
+}
+
+// WriteClose sends a close frame. The connection should still be closed
+// once the peer answers, or right away.
+func (c *Conn) WriteClose() error {
+	return c.writeFrame(opClose, nil)
+}
+
+// writeFrame sends a single frame, masked when sent by a client as required
+// by RFC 6455.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+
+	frame := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(len(payload)))
+	}
+
+	if c.client {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
@@ -0,0 +1,103 @@
+package websocket_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/pivotal-cf/cf-watch/websocket"
+)
+
+var _ = Describe("Conn", func() {
+	var (
+		server   *httptest.Server
+		endpoint string
+		accepted chan *Conn
+		headers  chan http.Header
+	)
+
+	BeforeEach(func() {
+		accepted = make(chan *Conn, 1)
+		headers = make(chan http.Header, 1)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header
+			conn, err := Upgrade(w, r)
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}))
+		endpoint = "ws://" + strings.TrimPrefix(server.URL, "http://")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should exchange messages between a client and a server", func() {
+		client, err := Dial(endpoint, "/some-path", http.Header{"Authorization": []string{"some-token"}}, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect((<-headers).Get("Authorization")).To(Equal("some-token"))
+		var conn *Conn
+		Eventually(accepted).Should(Receive(&conn))
+		defer conn.Close()
+
+		Expect(client.WriteText([]byte("some-request"))).To(Succeed())
+		Expect(conn.ReadMessage()).To(Equal([]byte("some-request")))
+
+		long := bytes.Repeat([]byte("a"), 70000)
+		Expect(conn.WriteText(long)).To(Succeed())
+		Expect(client.ReadMessage()).To(Equal(long))
+	})
+
+	It("should return io.EOF once the peer closes the connection", func() {
+		client, err := Dial(endpoint, "/", nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		var conn *Conn
+		Eventually(accepted).Should(Receive(&conn))
+
+		closed := make(chan error, 1)
+		go func() {
+			_, err := conn.ReadMessage()
+			closed <- err
+		}()
+		Expect(client.WriteClose()).To(Succeed())
+		Eventually(closed).Should(Receive(Equal(io.EOF)))
+		conn.Close()
+		_, err = client.ReadMessage()
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the server does not upgrade the connection", func() {
+		It("should return an error", func() {
+			plain := httptest.NewServer(http.NotFoundHandler())
+			defer plain.Close()
+
+			_, err := Dial("ws://"+strings.TrimPrefix(plain.URL, "http://"), "/", nil, false)
+			Expect(err).To(MatchError(ContainSubstring("404 Not Found")))
+		})
+	})
+
+	Context("when a plain HTTP request is upgraded", func() {
+		It("should respond with an error", func() {
+			response, err := http.Get(server.URL)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+			Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("with an unsupported endpoint", func() {
+		It("should return an error", func() {
+			_, err := Dial("https://example.com", "/", nil, false)
+			Expect(err).To(MatchError("unsupported endpoint: https://example.com"))
+		})
+	})
+})